@@ -0,0 +1,84 @@
+package androidbuilder
+
+import "strings"
+
+// ABI describes how go code is built for one android ABI.
+type ABI struct {
+	// GOARCH to build with, e.g. "arm64".
+	GOARCH string
+	// Name of the android ABI, also the directory in jniLibs, e.g. "arm64-v8a".
+	Name string
+	// Target is the clang target triple without the api level,
+	// e.g. "aarch64-none-linux-android".
+	Target string
+
+	GOARM   string
+	GOAMD64 string
+
+	// Tags are build tags added to the ones used for every ABI.
+	Tags []string
+	// Ldflags are added to the -ldflags used for every ABI.
+	Ldflags string
+
+	// CgoCFlags and CgoLDFlags are passed as CGO_CFLAGS and CGO_LDFLAGS,
+	// replacing the values from the environment.
+	CgoCFlags  string
+	CgoLDFlags string
+
+	// Env holds additional environment variables in "KEY=value" form.
+	Env []string
+}
+
+// DefaultABIs returns the ABIs supported by android, in the order of
+// preference of devices.
+func DefaultABIs() []ABI {
+	return []ABI{
+		{
+			GOARCH: "arm64",
+			Name:   "arm64-v8a",
+			Target: "aarch64-none-linux-android",
+		},
+		{
+			GOARCH: "arm",
+			Name:   "armeabi-v7a",
+			Target: "armv7-none-linux-androideabi",
+			GOARM:  "7",
+		},
+		{
+			GOARCH: "amd64",
+			Name:   "x86_64",
+			Target: "x86_64-none-linux-android",
+		},
+		{
+			GOARCH: "386",
+			Name:   "x86",
+			Target: "i686-none-linux-android",
+		},
+	}
+}
+
+// GoEnv returns the environment variables for the go command
+// to build for a, excluding GOOS and the c compiler.
+func (a ABI) GoEnv() []string {
+	env := []string{"GOARCH=" + a.GOARCH}
+	if a.GOARM != "" {
+		env = append(env, "GOARM="+a.GOARM)
+	}
+	if a.GOAMD64 != "" {
+		env = append(env, "GOAMD64="+a.GOAMD64)
+	}
+	if a.CgoCFlags != "" {
+		env = append(env, "CGO_CFLAGS="+a.CgoCFlags)
+	}
+	if a.CgoLDFlags != "" {
+		env = append(env, "CGO_LDFLAGS="+a.CgoLDFlags)
+	}
+	return append(env, a.Env...)
+}
+
+// BuildTags joins tags with the tags of a, in the form accepted by -tags.
+func (a ABI) BuildTags(tags string) string {
+	all := strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' })
+	all = append(all, a.Tags...)
+	return strings.Join(all, ",")
+}
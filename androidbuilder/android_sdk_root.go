@@ -1,7 +1,7 @@
 package androidbuilder
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -12,7 +12,7 @@ import (
 func GetAndroidSdkRoot() (path string, licenses bool, err error) {
 	path = os.Getenv("ANDROID_SDK_ROOT")
 	if path == "" {
-		return "", false, errors.New("getAndroidSdkRoot: env ANDROID_SDK_ROOT not set")
+		return "", false, fmt.Errorf("getAndroidSdkRoot: %w: env ANDROID_SDK_ROOT not set", ErrAndroidSdkNotFound)
 	}
 
 	licenses, err = checkAndroidSdkRoot(path)
@@ -26,7 +26,7 @@ func GetAndroidSdkRoot() (path string, licenses bool, err error) {
 func checkAndroidSdkRoot(androidSdkRoot string) (licenses bool, err error) {
 	entries, err := os.ReadDir(androidSdkRoot)
 	if err != nil {
-		return false, fmt.Errorf("checkAndroidSdkRoot: %w", err)
+		return false, fmt.Errorf("checkAndroidSdkRoot: %w: %v", ErrAndroidSdkNotFound, err)
 	}
 
 	var hasPlatformTools, hasCmdlineTools bool
@@ -45,19 +45,19 @@ func checkAndroidSdkRoot(androidSdkRoot string) (licenses bool, err error) {
 	if hasPlatformTools {
 		_, err = os.Stat(filepath.Join(androidSdkRoot, "platform-tools", getName("adb")))
 		if err != nil {
-			return false, fmt.Errorf("checkAndroidSdkRoot: %w", err)
+			return false, fmt.Errorf("checkAndroidSdkRoot: %w: %v", ErrAndroidSdkNotFound, err)
 		}
 	} else {
-		return false, errors.New("checkAndroidSdkRoot: unable to find \"platform-tools\" in " + androidSdkRoot)
+		return false, fmt.Errorf("checkAndroidSdkRoot: %w: unable to find \"platform-tools\" in %s", ErrAndroidSdkNotFound, androidSdkRoot)
 	}
 
 	if hasCmdlineTools {
 		_, err = os.Stat(filepath.Join(androidSdkRoot, "cmdline-tools", "latest", "bin", getName("sdkmanager")))
 		if err != nil {
-			return false, fmt.Errorf("checkAndroidSdkRoot: %w", err)
+			return false, fmt.Errorf("checkAndroidSdkRoot: %w: %v", ErrAndroidSdkNotFound, err)
 		}
 	} else {
-		return false, errors.New("checkAndroidSdkRoot: unable to find \"cmdline-tools\" in " + androidSdkRoot)
+		return false, fmt.Errorf("checkAndroidSdkRoot: %w: unable to find \"cmdline-tools\" in %s", ErrAndroidSdkNotFound, androidSdkRoot)
 	}
 
 	return licenses, nil
@@ -67,7 +67,7 @@ func findAndroidBuildTools(androidSdkRoot, targetSdkVersion string) (string, err
 	buildTools := filepath.Join(androidSdkRoot, "build-tools")
 	entries, err := os.ReadDir(buildTools)
 	if err != nil {
-		return "", fmt.Errorf("findAndroidBuildTools: %w", err)
+		return "", fmt.Errorf("findAndroidBuildTools: %w: %v", ErrBuildToolsNotFound, err)
 	}
 
 	latestVersion := ""
@@ -81,35 +81,51 @@ func findAndroidBuildTools(androidSdkRoot, targetSdkVersion string) (string, err
 	}
 
 	if latestVersion == "" {
-		return "", errors.New("findAndroidBuildTools: unable to find \"build-tools\" for targetSdkVersion=" + targetSdkVersion)
+		return "", fmt.Errorf("findAndroidBuildTools: %w: unable to find \"build-tools\" for targetSdkVersion=%s", ErrBuildToolsNotFound, targetSdkVersion)
 	}
 
 	return filepath.Join(buildTools, latestVersion), nil
 }
 
-func downloadAndroidBuildtools(androidSdkRoot, targetSdkVersion string) (string, error) {
-	latestVersion, err := FindLatestVersionOfSdk("build-tools", targetSdkVersion, true)
+func downloadAndroidBuildtools(ctx context.Context, logger *Logger, androidSdkRoot, targetSdkVersion string) (string, error) {
+	latestVersion, err := FindLatestVersionOfSdkContext(ctx, "build-tools", targetSdkVersion, true)
 	if err != nil {
 		return "", fmt.Errorf("downloadAndroidBuildtools: %w", err)
 	}
 
 	// if found install it via sdkmanager
-	sdkmanager := filepath.Join(androidSdkRoot, "cmdline-tools", "latest", "bin", getName("sdkmanager"))
-	cmd := exec.Command(sdkmanager, "build-tools;"+latestVersion)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	dir := filepath.Join(androidSdkRoot, "build-tools", latestVersion)
+	err = sdkmanagerInstall(ctx, logger, androidSdkRoot, "build-tools;"+latestVersion, dir)
 	if err != nil {
 		return "", fmt.Errorf("downloadAndroidBuildtools: %w", err)
 	}
 
-	return filepath.Join(androidSdkRoot, "build-tools", latestVersion), nil
+	return dir, nil
+}
+
+// sdkmanagerInstall installs pkg to dir in the sdk, if ctx is done
+// before it finishes a partially installed dir is removed
+func sdkmanagerInstall(ctx context.Context, logger *Logger, androidSdkRoot, pkg, dir string) error {
+	_, err := os.Stat(dir)
+	existed := err == nil
+
+	sdkmanager := filepath.Join(androidSdkRoot, "cmdline-tools", "latest", "bin", getName("sdkmanager"))
+	cmd := exec.Command(sdkmanager, pkg)
+	out, err := logger.run(ctx, cmd)
+	if err != nil {
+		if ctx.Err() != nil && !existed {
+			_ = os.RemoveAll(dir)
+		}
+		return &CommandError{Path: cmd.Path, Args: cmd.Args[1:], Output: out, Err: err}
+	}
+
+	return nil
 }
 
 func checkAndroidBuildTools(buildTools string) error {
 	entries, err := os.ReadDir(buildTools)
 	if err != nil {
-		return fmt.Errorf("checkAndroidBuildTools: %w", err)
+		return fmt.Errorf("checkAndroidBuildTools: %w: %v", ErrBuildToolsNotFound, err)
 	}
 
 	var hasAapt2, hasD8, hasZipalign, hasApksigner bool
@@ -144,7 +160,7 @@ func checkAndroidBuildTools(buildTools string) error {
 	}
 
 	if len(toolsNotFound) > 0 {
-		return errors.New("checkAndroidBuildTools: unable to find " + strings.Join(toolsNotFound, ", ") + " in " + buildTools)
+		return fmt.Errorf("checkAndroidBuildTools: %w: unable to find %s in %s", ErrBuildToolsNotFound, strings.Join(toolsNotFound, ", "), buildTools)
 	}
 
 	return nil
@@ -154,7 +170,7 @@ func findAndroidPlatform(androidSdkRoot, targetSdkVersion string) (string, error
 	platforms := filepath.Join(androidSdkRoot, "platforms")
 	entries, err := os.ReadDir(platforms)
 	if err != nil {
-		return "", fmt.Errorf("findAndroidPlatform: %w", err)
+		return "", fmt.Errorf("findAndroidPlatform: %w: %v", ErrPlatformNotFound, err)
 	}
 
 	for _, entry := range entries {
@@ -166,26 +182,23 @@ func findAndroidPlatform(androidSdkRoot, targetSdkVersion string) (string, error
 		}
 	}
 
-	return "", errors.New("findAndroidPlatform: unable to find \"android-" + targetSdkVersion + "\" in " + platforms)
+	return "", fmt.Errorf("findAndroidPlatform: %w: unable to find \"android-%s\" in %s", ErrPlatformNotFound, targetSdkVersion, platforms)
 }
 
-func downloadAndroidPlatform(androidSdkRoot, targetSdkVersion string) (string, error) {
-	sdkmanager := filepath.Join(androidSdkRoot, "cmdline-tools", "latest", "bin", getName("sdkmanager"))
-	cmd := exec.Command(sdkmanager, "platforms;android-"+targetSdkVersion)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+func downloadAndroidPlatform(ctx context.Context, logger *Logger, androidSdkRoot, targetSdkVersion string) (string, error) {
+	dir := filepath.Join(androidSdkRoot, "platforms", "android-"+targetSdkVersion)
+	err := sdkmanagerInstall(ctx, logger, androidSdkRoot, "platforms;android-"+targetSdkVersion, dir)
 	if err != nil {
 		return "", fmt.Errorf("downloadAndroidPlatform: %w", err)
 	}
 
-	return filepath.Join(androidSdkRoot, "platforms", "android-"+targetSdkVersion), nil
+	return dir, nil
 }
 
 func checkAndroidPlatform(platformDir string) error {
 	entries, err := os.ReadDir(platformDir)
 	if err != nil {
-		return fmt.Errorf("checkAndroidPlatform: %w", err)
+		return fmt.Errorf("checkAndroidPlatform: %w: %v", ErrPlatformNotFound, err)
 	}
 
 	for _, entry := range entries {
@@ -196,5 +209,5 @@ func checkAndroidPlatform(platformDir string) error {
 		}
 	}
 
-	return errors.New("checkAndroidPlatform: unable to find \"android.jar\" in " + platformDir)
+	return fmt.Errorf("checkAndroidPlatform: %w: unable to find \"android.jar\" in %s", ErrPlatformNotFound, platformDir)
 }
@@ -1,13 +1,14 @@
 package androidbuilder
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type JavaTools struct {
@@ -34,6 +35,14 @@ type CustomBuilder struct {
 }
 
 func NewCustomBuilder(androidDir string, autoDownloadPackages bool) (*CustomBuilder, error) {
+	return NewCustomBuilderContext(context.Background(), androidDir, autoDownloadPackages)
+}
+
+// NewCustomBuilderContext is like NewCustomBuilder, downloads of missing
+// packages are aborted when ctx is done.
+func NewCustomBuilderContext(ctx context.Context, androidDir string, autoDownloadPackages bool, opts ...DownloadOption) (*CustomBuilder, error) {
+	options := newDownloadOptions(opts)
+
 	minSdk, targetSdk, err := FindMinSdkAndTargetSdk(androidDir)
 	if err != nil {
 		return nil, err
@@ -50,14 +59,14 @@ func NewCustomBuilder(androidDir string, autoDownloadPackages bool) (*CustomBuil
 	}
 
 	if !licenses {
-		sdkmanager := filepath.Join(androidSdkRoot, "platform-tools", "sdkmanager")
-		return nil, errors.New("android sdk licenses not accepted, run \"" + sdkmanager + " --licenses\"")
+		sdkmanager := filepath.Join(androidSdkRoot, "cmdline-tools", "latest", "bin", getName("sdkmanager"))
+		return nil, fmt.Errorf("%w, run \"%s --licenses\"", ErrLicensesNotAccepted, sdkmanager)
 	}
 
 	buildTools, err := findAndroidBuildTools(androidSdkRoot, targetSdk)
 	if err != nil {
 		if autoDownloadPackages {
-			buildTools, err = downloadAndroidBuildtools(androidSdkRoot, targetSdk)
+			buildTools, err = downloadAndroidBuildtools(ctx, options.logger, androidSdkRoot, targetSdk)
 			if err != nil {
 				return nil, err
 			}
@@ -74,7 +83,7 @@ func NewCustomBuilder(androidDir string, autoDownloadPackages bool) (*CustomBuil
 	platformDir, err := findAndroidPlatform(androidSdkRoot, targetSdk)
 	if err != nil {
 		if autoDownloadPackages {
-			platformDir, err = downloadAndroidPlatform(androidSdkRoot, targetSdk)
+			platformDir, err = downloadAndroidPlatform(ctx, options.logger, androidSdkRoot, targetSdk)
 			if err != nil {
 				return nil, err
 			}
@@ -108,6 +117,8 @@ func NewCustomBuilder(androidDir string, autoDownloadPackages bool) (*CustomBuil
 }
 
 type customBuildApkOptions struct {
+	ctx context.Context
+
 	androidDir string
 	targetDir  string
 
@@ -116,6 +127,13 @@ type customBuildApkOptions struct {
 
 	javacSourceCompatibility string
 	javacTargetCompatibility string
+
+	// java sources of the app, apps without any, e.g. using
+	// NativeActivity, are packaged without classes.dex
+	javaSources []string
+
+	eventHandler EventHandler
+	logger       *Logger
 }
 
 type CustomBuildApkOption func(*customBuildApkOptions)
@@ -143,27 +161,51 @@ func CustomBuildOptJavacCompatibility(source, target string) CustomBuildApkOptio
 	}
 }
 
-func (b *CustomBuilder) BuildApk(androidDir string, targetDir string, opts ...CustomBuildApkOption) (string, error) {
-	keystore, err := findOrGenerateDebugKeystore(b.JavaTools.Keytool)
-	if err != nil {
-		return "", err
+// Receive build events via h.
+func CustomBuildOptEventHandler(h EventHandler) CustomBuildApkOption {
+	return func(opts *customBuildApkOptions) {
+		opts.eventHandler = h
+	}
+}
+
+// Log commands and output of tools via l.
+func CustomBuildOptLogger(l *Logger) CustomBuildApkOption {
+	return func(opts *customBuildApkOptions) {
+		opts.logger = l
 	}
+}
+
+func (b *CustomBuilder) BuildApk(androidDir string, targetDir string, opts ...CustomBuildApkOption) (string, error) {
+	return b.BuildApkContext(context.Background(), androidDir, targetDir, opts...)
+}
 
+// BuildApkContext is like BuildApk, when ctx is done running tools are
+// killed and partial outputs in targetDir are removed.
+func (b *CustomBuilder) BuildApkContext(ctx context.Context, androidDir string, targetDir string, opts ...CustomBuildApkOption) (string, error) {
 	buildOpts := &customBuildApkOptions{
+		ctx: ctx,
+
 		androidDir: androidDir,
 		targetDir:  targetDir,
 
 		javacSourceCompatibility: "8",
 		javacTargetCompatibility: "8",
-
-		keystorePath: keystore,
-		keystorePass: "pass:android",
 	}
 
 	for _, opt := range opts {
 		opt(buildOpts)
 	}
 
+	if buildOpts.keystorePath == "" {
+		keystore, err := findOrGenerateDebugKeystore(ctx, buildOpts.logger, b.JavaTools.Keytool)
+		if err != nil {
+			return "", err
+		}
+
+		buildOpts.keystorePath = keystore
+		buildOpts.keystorePass = "pass:android"
+	}
+
 	return b.buildApk(buildOpts)
 }
 
@@ -173,24 +215,31 @@ func (b *CustomBuilder) buildApk(opts *customBuildApkOptions) (string, error) {
 		return "", err
 	}
 
-	err = b.compileResources(opts)
+	opts.javaSources, err = findJavaSources(opts.androidDir)
 	if err != nil {
 		return "", err
 	}
 
-	err = b.compileSources(opts)
-	if err != nil {
-		return "", err
+	type step struct {
+		name string
+		fn   func(*customBuildApkOptions) error
 	}
-
-	err = b.mergeApk(opts)
-	if err != nil {
-		return "", err
+	steps := []step{{"compileResources", b.compileResources}}
+	if len(opts.javaSources) > 0 {
+		steps = append(steps, step{"compileSources", b.compileSources})
 	}
+	steps = append(steps, step{"mergeApk", b.mergeApk}, step{"signApk", b.signApk})
 
-	err = b.signApk(opts)
-	if err != nil {
-		return "", err
+	for _, step := range steps {
+		err = opts.eventHandler.step(step.name, func() error {
+			return step.fn(opts)
+		})
+		if err != nil {
+			if opts.ctx.Err() != nil {
+				_ = os.RemoveAll(opts.targetDir)
+			}
+			return "", err
+		}
 	}
 
 	return filepath.Join(opts.targetDir, "app.apk"), nil
@@ -213,27 +262,36 @@ func (b *CustomBuilder) compileResources(opts *customBuildApkOptions) error {
 
 	resDir := filepath.Join(opts.androidDir, "app", "src", "main", "res")
 	resZip := filepath.Join(intermediatesDir, "res.zip")
-	err = b.runCmd(exec.Command(b.AndroidBuildTools.Aapt2, "compile", "-o", resZip, "--dir", resDir))
+	err = b.runCmd(opts, "compileResources", exec.Command(b.AndroidBuildTools.Aapt2, "compile", "-o", resZip, "--dir", resDir))
 	if err != nil {
 		return fmt.Errorf("compileResources: %w", err)
 	}
 
 	unalignedApk := filepath.Join(intermediatesDir, "unaligned.apk")
 
-	err = b.runCmd(exec.Command(
-		b.AndroidBuildTools.Aapt2, "link",
+	args := []string{
+		"link",
 		"-o", unalignedApk,
 		"--manifest", appManifest,
 		"-I", b.AndroidJar,
-		"--java", intermediatesDir,
 		"--output-text-symbols", filepath.Join(intermediatesDir, "R.txt"),
-		resZip,
-	))
+	}
+	// R.java is only needed to compile java sources
+	if len(opts.javaSources) > 0 {
+		args = append(args, "--java", intermediatesDir)
+	}
+	args = append(args, resZip)
+
+	err = b.runCmd(opts, "compileResources", exec.Command(b.AndroidBuildTools.Aapt2, args...))
 	if err != nil {
 		return fmt.Errorf("compileResources: %w", err)
 	}
 
-	err = b.runCmd(exec.Command(
+	if len(opts.javaSources) == 0 {
+		return nil
+	}
+
+	err = b.runCmd(opts, "compileResources", exec.Command(
 		b.JavaTools.Javac,
 		"-source", opts.javacSourceCompatibility,
 		"-target", opts.javacTargetCompatibility,
@@ -245,7 +303,7 @@ func (b *CustomBuilder) compileResources(opts *customBuildApkOptions) error {
 		return fmt.Errorf("compileResources: %w", err)
 	}
 
-	err = b.runCmd(exec.Command(
+	err = b.runCmd(opts, "compileResources", exec.Command(
 		b.JavaTools.Jar,
 		"--create",
 		"--file", filepath.Join(intermediatesDir, "R.jar"),
@@ -269,18 +327,6 @@ func (b *CustomBuilder) compileSources(opts *customBuildApkOptions) error {
 	}
 	pkgPath := filepath.Join(strings.Split(pkg, ".")...)
 
-	srcDir := filepath.Join(opts.androidDir, "app", "src")
-	var srces []string
-	err = fs.WalkDir(os.DirFS(srcDir), ".", func(path string, d fs.DirEntry, _ error) error {
-		if d != nil && d.Type().IsRegular() && strings.HasSuffix(path, ".java") {
-			srces = append(srces, filepath.Join(srcDir, path))
-		}
-		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("compileSources: %w", err)
-	}
-
 	intermediatesDir := filepath.Join(opts.targetDir, "intermediates")
 
 	jars := []string{
@@ -295,9 +341,9 @@ func (b *CustomBuilder) compileSources(opts *customBuildApkOptions) error {
 			"-classpath", strings.Join(jars, string(os.PathListSeparator)),
 			"-d", intermediatesDir,
 		}
-		args = append(args, srces...)
+		args = append(args, opts.javaSources...)
 
-		err = b.runCmd(exec.Command(b.JavaTools.Javac, args...))
+		err = b.runCmd(opts, "compileSources", exec.Command(b.JavaTools.Javac, args...))
 		if err != nil {
 			return fmt.Errorf("compileSources: %w", err)
 		}
@@ -323,7 +369,7 @@ func (b *CustomBuilder) compileSources(opts *customBuildApkOptions) error {
 		}
 		args = append(args, classes...)
 
-		err = b.runCmd(exec.Command(b.AndroidBuildTools.D8, args...))
+		err = b.runCmd(opts, "compileSources", exec.Command(b.AndroidBuildTools.D8, args...))
 		if err != nil {
 			return fmt.Errorf("compileSources: %w", err)
 		}
@@ -332,13 +378,31 @@ func (b *CustomBuilder) compileSources(opts *customBuildApkOptions) error {
 	return nil
 }
 
+// findJavaSources returns the .java files in the "app/src" directory of
+// androidDir
+func findJavaSources(androidDir string) ([]string, error) {
+	srcDir := filepath.Join(androidDir, "app", "src")
+	var srces []string
+	err := fs.WalkDir(os.DirFS(srcDir), ".", func(path string, d fs.DirEntry, _ error) error {
+		if d != nil && d.Type().IsRegular() && strings.HasSuffix(path, ".java") {
+			srces = append(srces, filepath.Join(srcDir, path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("findJavaSources: %w", err)
+	}
+	return srces, nil
+}
+
 func (b *CustomBuilder) mergeApk(opts *customBuildApkOptions) error {
 	intermediatesDir := filepath.Join(opts.targetDir, "intermediates")
 	unaligned := filepath.Join(intermediatesDir, "unaligned.apk")
 
 	// PathOnHost -> PathInZip
-	files := map[string]string{
-		filepath.Join(intermediatesDir, "classes.dex"): "classes.dex",
+	files := map[string]string{}
+	if len(opts.javaSources) > 0 {
+		files[filepath.Join(intermediatesDir, "classes.dex")] = "classes.dex"
 	}
 
 	matches, err := filepath.Glob(filepath.Join(opts.androidDir, "app", "src", "main", "jniLibs", "*", "*.so"))
@@ -349,17 +413,7 @@ func (b *CustomBuilder) mergeApk(opts *customBuildApkOptions) error {
 		files[match] = filepath.Join("lib", filepath.Base(filepath.Dir(match)), filepath.Base(match))
 	}
 
-	err = addFilesToZip(unaligned, files)
-	if err != nil {
-		return fmt.Errorf("mergeApk: %w", err)
-	}
-
-	err = b.runCmd(exec.Command(
-		b.AndroidBuildTools.Zipalign,
-		"-f", "4",
-		unaligned,
-		filepath.Join(intermediatesDir, "aligned.apk"),
-	))
+	err = writeAlignedZip(opts.ctx, unaligned, filepath.Join(intermediatesDir, "aligned.apk"), files)
 	if err != nil {
 		return fmt.Errorf("mergeApk: %w", err)
 	}
@@ -370,7 +424,7 @@ func (b *CustomBuilder) mergeApk(opts *customBuildApkOptions) error {
 func (b *CustomBuilder) signApk(opts *customBuildApkOptions) error {
 	intermediatesDir := filepath.Join(opts.targetDir, "intermediates")
 
-	err := b.runCmd(exec.Command(
+	err := b.runCmd(opts, "signApk", exec.Command(
 		b.AndroidBuildTools.Apksigner,
 		"sign",
 		"--ks", opts.keystorePath,
@@ -386,12 +440,12 @@ func (b *CustomBuilder) signApk(opts *customBuildApkOptions) error {
 	return nil
 }
 
-func (b *CustomBuilder) runCmd(cmd *exec.Cmd) error {
-	o, err := cmd.CombinedOutput()
-	fmt.Println(cmd.String())
+func (b *CustomBuilder) runCmd(opts *customBuildApkOptions, step string, cmd *exec.Cmd) error {
+	start := time.Now()
+	out, err := opts.logger.run(opts.ctx, cmd)
+	opts.eventHandler.command(step, cmd, start, err)
 	if err != nil {
-		os.Stderr.Write(o)
-		return err
+		return &CommandError{Path: cmd.Path, Args: cmd.Args[1:], Output: out, Err: err}
 	}
 	return nil
 }
@@ -0,0 +1,165 @@
+package androidbuilder
+
+import (
+	"debug/elf"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PageSize16K is the page size of devices with 16 KB pages, LOAD segments
+// of native libraries need to be aligned to it to load on them.
+const PageSize16K = 16384
+
+// CheckPageAlignment checks that every PT_LOAD segment of the ELF file
+// name is aligned to pageSize, e.g. PageSize16K.
+func CheckPageAlignment(name string, pageSize uint64) error {
+	f, err := elf.Open(name)
+	if err != nil {
+		return fmt.Errorf("CheckPageAlignment: %w", err)
+	}
+	defer f.Close()
+
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD {
+			continue
+		}
+
+		if p.Align < pageSize || p.Align%pageSize != 0 || p.Off%pageSize != p.Vaddr%pageSize {
+			return fmt.Errorf("CheckPageAlignment: %w: %s has a LOAD segment at offset %#x aligned to %d bytes, expected %d",
+				ErrSegmentNotAligned, name, p.Off, p.Align, pageSize)
+		}
+	}
+
+	return nil
+}
+
+// CheckLibrary inspects the native library name before it is packaged.
+// Every library it needs has to be in available, names of the system
+// libraries (see NDKToolchain.SystemLibraries) and of the libraries packaged
+// along with it. It also has to export a JNI entry point and must not have
+// text relocations.
+//
+// Problems found are returned wrapping ErrLibraryNotFound, ErrNoEntryPoint
+// or ErrTextRelocations, err is set only if name couldn't be read.
+func CheckLibrary(name string, available []string) (problems []error, err error) {
+	f, err := elf.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("CheckLibrary: %w", err)
+	}
+	defer f.Close()
+
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return nil, fmt.Errorf("CheckLibrary: %s: %w", name, err)
+	}
+	for _, lib := range needed {
+		if !contains(available, lib) {
+			problems = append(problems, fmt.Errorf("%w: %s needs %s, which is neither a system library at this minSdkVersion nor packaged in the app",
+				ErrLibraryNotFound, filepath.Base(name), lib))
+		}
+	}
+
+	exported, err := exportedFunctions(f)
+	if err != nil {
+		return nil, fmt.Errorf("CheckLibrary: %s: %w", name, err)
+	}
+	if !hasEntryPoint(exported) {
+		problems = append(problems, fmt.Errorf("%w: %s exports no Java_* function, JNI_OnLoad or ANativeActivity_onCreate",
+			ErrNoEntryPoint, filepath.Base(name)))
+	}
+
+	textrel, err := hasTextRelocations(f)
+	if err != nil {
+		return nil, fmt.Errorf("CheckLibrary: %s: %w", name, err)
+	}
+	if textrel {
+		problems = append(problems, fmt.Errorf("%w: %s has relocations in its text segment",
+			ErrTextRelocations, filepath.Base(name)))
+	}
+
+	return problems, nil
+}
+
+// ExportedFunctions returns names of the functions exported by the
+// native library name, e.g. the ones marked with //export in Go.
+func ExportedFunctions(name string) ([]string, error) {
+	f, err := elf.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("ExportedFunctions: %w", err)
+	}
+	defer f.Close()
+
+	exported, err := exportedFunctions(f)
+	if err != nil {
+		return nil, fmt.Errorf("ExportedFunctions: %s: %w", name, err)
+	}
+	return exported, nil
+}
+
+func exportedFunctions(f *elf.File) ([]string, error) {
+	syms, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+
+	var names []string
+	for _, sym := range syms {
+		if sym.Section == elf.SHN_UNDEF || elf.ST_TYPE(sym.Info) != elf.STT_FUNC {
+			continue
+		}
+		if bind := elf.ST_BIND(sym.Info); bind != elf.STB_GLOBAL && bind != elf.STB_WEAK {
+			continue
+		}
+		names = append(names, sym.Name)
+	}
+	return names, nil
+}
+
+func hasEntryPoint(exported []string) bool {
+	for _, name := range exported {
+		if strings.HasPrefix(name, "Java_") || name == "JNI_OnLoad" || name == "ANativeActivity_onCreate" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTextRelocations reports whether the dynamic section of f has
+// DT_TEXTREL or DF_TEXTREL in DT_FLAGS
+func hasTextRelocations(f *elf.File) (bool, error) {
+	s := f.SectionByType(elf.SHT_DYNAMIC)
+	if s == nil {
+		return false, nil
+	}
+	d, err := s.Data()
+	if err != nil {
+		return false, err
+	}
+
+	size := 8
+	if f.Class == elf.ELFCLASS64 {
+		size = 16
+	}
+
+	for ; len(d) >= size; d = d[size:] {
+		var tag, val uint64
+		if f.Class == elf.ELFCLASS64 {
+			tag, val = f.ByteOrder.Uint64(d[0:8]), f.ByteOrder.Uint64(d[8:16])
+		} else {
+			tag, val = uint64(f.ByteOrder.Uint32(d[0:4])), uint64(f.ByteOrder.Uint32(d[4:8]))
+		}
+
+		switch elf.DynTag(tag) {
+		case elf.DT_NULL:
+			return false, nil
+		case elf.DT_TEXTREL:
+			return true, nil
+		case elf.DT_FLAGS:
+			if val&uint64(elf.DF_TEXTREL) != 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
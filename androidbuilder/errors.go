@@ -0,0 +1,87 @@
+package androidbuilder
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// Sentinel errors, returned wrapped so they can be matched with errors.Is.
+var (
+	// ErrAndroidSdkNotFound is returned when ANDROID_SDK_ROOT is not set or
+	// doesn't point to a usable android sdk.
+	ErrAndroidSdkNotFound = errors.New("android sdk not found")
+
+	// ErrLicensesNotAccepted is returned when android sdk licenses have not
+	// been accepted via sdkmanager.
+	ErrLicensesNotAccepted = errors.New("android sdk licenses not accepted")
+
+	// ErrNdkNotFound is returned when no android ndk is installed in the sdk.
+	ErrNdkNotFound = errors.New("android ndk not found")
+
+	// ErrNdkToolchainNotFound is returned when the ndk doesn't contain
+	// a prebuilt llvm toolchain usable on this host.
+	ErrNdkToolchainNotFound = errors.New("ndk llvm toolchain not found")
+
+	// ErrJavaHomeNotFound is returned when no usable jdk can be found.
+	ErrJavaHomeNotFound = errors.New("jdk not found")
+
+	// ErrBuildToolsNotFound is returned when android build-tools for the
+	// targetSdkVersion are missing or incomplete.
+	ErrBuildToolsNotFound = errors.New("android build-tools not found")
+
+	// ErrPlatformNotFound is returned when the android platform for the
+	// targetSdkVersion is missing or incomplete.
+	ErrPlatformNotFound = errors.New("android platform not found")
+
+	// ErrSegmentNotAligned is returned when a LOAD segment of a native
+	// library is not aligned to the page size it has to load with.
+	ErrSegmentNotAligned = errors.New("LOAD segment not page aligned")
+
+	// ErrLibraryNotFound is returned when a native library depends on a
+	// library that is neither a system library nor packaged with it.
+	ErrLibraryNotFound = errors.New("needed library not found")
+
+	// ErrNoEntryPoint is returned when a native library exports none of the
+	// functions android calls into, "Java_*", JNI_OnLoad or
+	// ANativeActivity_onCreate.
+	ErrNoEntryPoint = errors.New("no JNI entry point exported")
+
+	// ErrTextRelocations is returned when a native library has relocations
+	// in its text segment, which android refuses to load since API 23.
+	ErrTextRelocations = errors.New("text relocations")
+
+	// ErrGradlewNotFound is returned when the android directory doesn't
+	// contain a gradle wrapper.
+	ErrGradlewNotFound = errors.New("gradlew not found")
+)
+
+// CommandError is returned when an external tool exits with an error.
+type CommandError struct {
+	// Path of the tool that was run.
+	Path string
+	Args []string
+	// Combined output of the tool, if it was captured.
+	Output []byte
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	return filepath.Base(e.Path) + " " + strings.Join(e.Args, " ") + ": " + e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// GradleError is returned when a gradle task fails.
+type GradleError struct {
+	// AndroidDir is the directory gradlew was run in.
+	AndroidDir string
+	Task       string
+	Err        error
+}
+
+func (e *GradleError) Error() string {
+	return "gradle task " + e.Task + " failed: " + e.Err.Error()
+}
+
+func (e *GradleError) Unwrap() error { return e.Err }
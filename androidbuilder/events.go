@@ -0,0 +1,60 @@
+package androidbuilder
+
+import (
+	"os/exec"
+	"time"
+)
+
+type EventKind string
+
+const (
+	EventStepStarted  EventKind = "step-started"
+	EventStepFinished EventKind = "step-finished"
+	EventCommand      EventKind = "command"
+	EventWarning      EventKind = "warning"
+)
+
+// Event describes progress of a build, it is passed to the EventHandler
+// provided via builder options.
+type Event struct {
+	Kind EventKind
+
+	// Step is the name of the build step, e.g. "compileResources" or "assembleDebug"
+	Step string
+
+	// Command is the command line of the external tool, set for EventCommand
+	Command []string
+
+	// Duration is set for EventStepFinished and EventCommand
+	Duration time.Duration
+
+	// Err is set if the step or the command failed
+	Err error
+
+	// Message is set for EventWarning
+	Message string
+}
+
+// EventHandler is called synchronously for every build event.
+type EventHandler func(Event)
+
+func (h EventHandler) emit(e Event) {
+	if h != nil {
+		h(e)
+	}
+}
+
+// step reports start and end of fn as a build step
+func (h EventHandler) step(name string, fn func() error) error {
+	h.emit(Event{Kind: EventStepStarted, Step: name})
+
+	start := time.Now()
+	err := fn()
+
+	h.emit(Event{Kind: EventStepFinished, Step: name, Duration: time.Since(start), Err: err})
+	return err
+}
+
+func (h EventHandler) command(step string, cmd *exec.Cmd, start time.Time, err error) {
+	h.emit(Event{Kind: EventCommand, Step: step, Command: cmd.Args, Duration: time.Since(start), Err: err})
+}
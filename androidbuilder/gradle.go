@@ -1,11 +1,13 @@
 package androidbuilder
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 )
 
 type GradleBuilder struct{}
@@ -15,9 +17,14 @@ func NewGradleBuilder() (*GradleBuilder, error) {
 }
 
 type gradleBuildApkOptions struct {
+	ctx context.Context
+
 	androidDir string
 
 	release bool
+
+	eventHandler EventHandler
+	logger       *Logger
 }
 
 type GradleBuildApkOption func(*gradleBuildApkOptions)
@@ -28,7 +35,27 @@ func GradleBuilderOptRelease() GradleBuildApkOption {
 	}
 }
 
+// Receive build events via h.
+func GradleBuilderOptEventHandler(h EventHandler) GradleBuildApkOption {
+	return func(opts *gradleBuildApkOptions) {
+		opts.eventHandler = h
+	}
+}
+
+// Log commands and output of gradle via l.
+func GradleBuilderOptLogger(l *Logger) GradleBuildApkOption {
+	return func(opts *gradleBuildApkOptions) {
+		opts.logger = l
+	}
+}
+
 func (b *GradleBuilder) BuildApk(androidDir string, opts ...GradleBuildApkOption) (string, error) {
+	return b.BuildApkContext(context.Background(), androidDir, opts...)
+}
+
+// BuildApkContext is like BuildApk, when ctx is done gradle is killed along
+// with the processes it started.
+func (b *GradleBuilder) BuildApkContext(ctx context.Context, androidDir string, opts ...GradleBuildApkOption) (string, error) {
 	if filepath.Clean(androidDir) == "." {
 		dir, err := os.Getwd()
 		if err != nil {
@@ -39,6 +66,7 @@ func (b *GradleBuilder) BuildApk(androidDir string, opts ...GradleBuildApkOption
 	}
 
 	options := &gradleBuildApkOptions{
+		ctx:        ctx,
 		androidDir: androidDir,
 	}
 	for _, opt := range opts {
@@ -49,7 +77,7 @@ func (b *GradleBuilder) BuildApk(androidDir string, opts ...GradleBuildApkOption
 
 	_, err := os.Stat(gradlew)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %v", ErrGradlewNotFound, err)
 	}
 
 	command := "assembleDebug"
@@ -57,14 +85,16 @@ func (b *GradleBuilder) BuildApk(androidDir string, opts ...GradleBuildApkOption
 		command = "assembleRelease"
 	}
 
-	cmd := exec.Command(gradlew, command)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = androidDir
-	fmt.Println(cmd.String())
-	err = cmd.Run()
+	err = options.eventHandler.step(command, func() error {
+		cmd := exec.Command(gradlew, command)
+		cmd.Dir = androidDir
+		start := time.Now()
+		_, err := options.logger.run(options.ctx, cmd)
+		options.eventHandler.command(command, cmd, start, err)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return "", &GradleError{AndroidDir: androidDir, Task: command, Err: err}
 	}
 
 	if !options.release {
@@ -87,6 +117,12 @@ func (b *GradleBuilder) BuildApk(androidDir string, opts ...GradleBuildApkOption
 }
 
 func (b *GradleBuilder) BuildAppbundle(androidDir string, opts ...GradleBuildApkOption) (string, error) {
+	return b.BuildAppbundleContext(context.Background(), androidDir, opts...)
+}
+
+// BuildAppbundleContext is like BuildAppbundle, when ctx is done gradle is killed along
+// with the processes it started.
+func (b *GradleBuilder) BuildAppbundleContext(ctx context.Context, androidDir string, opts ...GradleBuildApkOption) (string, error) {
 	if filepath.Clean(androidDir) == "." {
 		dir, err := os.Getwd()
 		if err != nil {
@@ -97,6 +133,7 @@ func (b *GradleBuilder) BuildAppbundle(androidDir string, opts ...GradleBuildApk
 	}
 
 	options := &gradleBuildApkOptions{
+		ctx:        ctx,
 		androidDir: androidDir,
 	}
 	for _, opt := range opts {
@@ -107,7 +144,7 @@ func (b *GradleBuilder) BuildAppbundle(androidDir string, opts ...GradleBuildApk
 
 	_, err := os.Stat(gradlew)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %v", ErrGradlewNotFound, err)
 	}
 
 	command := "bundleDebug"
@@ -115,14 +152,16 @@ func (b *GradleBuilder) BuildAppbundle(androidDir string, opts ...GradleBuildApk
 		command = "bundleRelease"
 	}
 
-	cmd := exec.Command(gradlew, command)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = androidDir
-	fmt.Println(cmd.String())
-	err = cmd.Run()
+	err = options.eventHandler.step(command, func() error {
+		cmd := exec.Command(gradlew, command)
+		cmd.Dir = androidDir
+		start := time.Now()
+		_, err := options.logger.run(options.ctx, cmd)
+		options.eventHandler.command(command, cmd, start, err)
+		return err
+	})
 	if err != nil {
-		return "", err
+		return "", &GradleError{AndroidDir: androidDir, Task: command, Err: err}
 	}
 
 	if options.release {
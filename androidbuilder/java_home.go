@@ -3,6 +3,7 @@ package androidbuilder
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -11,6 +12,12 @@ import (
 	"strings"
 )
 
+// FindJavaHome returns JAVA_HOME if set, otherwise it tries to find it
+// using the java binary in PATH.
+func FindJavaHome() (string, error) {
+	return getJavaHome()
+}
+
 func getJavaHome() (string, error) {
 	// first try JAVA_HOME env var
 	env := os.Getenv("JAVA_HOME")
@@ -18,7 +25,7 @@ func getJavaHome() (string, error) {
 		err := checkJavaHome(env)
 		if err != nil {
 			// fail fast if JAVA_HOME doesn't have required binaries
-			return "", fmt.Errorf("getJavaHome: invalid JAVA_HOME: %w", err)
+			return "", fmt.Errorf("getJavaHome: %w: invalid JAVA_HOME: %v", ErrJavaHomeNotFound, err)
 		}
 		return env, nil
 	}
@@ -26,7 +33,7 @@ func getJavaHome() (string, error) {
 	// fallback
 	javaHome := tryFindJavaHome()
 	if javaHome == "" {
-		return "", errors.New("getJavaHome: unable to find JAVA_HOME")
+		return "", fmt.Errorf("getJavaHome: %w: unable to find JAVA_HOME", ErrJavaHomeNotFound)
 	}
 
 	// TODO: try jre from android studio
@@ -117,10 +124,10 @@ func checkJavaHome(javaHome string) error {
 	return nil
 }
 
-func findOrGenerateDebugKeystore(keytool string) (string, error) {
+func findOrGenerateDebugKeystore(ctx context.Context, logger *Logger, keytool string) (string, error) {
 	keystore, err := findDebugKeystore()
 	if err != nil {
-		keystore, err = generateDebugKeystore(keytool)
+		keystore, err = generateDebugKeystore(ctx, logger, keytool)
 		if err != nil {
 			return "", err
 		}
@@ -144,7 +151,7 @@ func findDebugKeystore() (string, error) {
 	return debugKeystore, nil
 }
 
-func generateDebugKeystore(keytool string) (string, error) {
+func generateDebugKeystore(ctx context.Context, logger *Logger, keytool string) (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("generateDebugKeystore: %w", err)
@@ -161,11 +168,10 @@ func generateDebugKeystore(keytool string) (string, error) {
 		"-keypass", "android",
 		"-dname", "CN=Android Debug,O=Android,C=US",
 	)
-	out, err := cmd.CombinedOutput()
+	out, err := logger.run(ctx, cmd)
 	if err != nil {
-		os.Stderr.Write(out)
-		return "", fmt.Errorf("compileResources: %w", err)
+		return "", fmt.Errorf("generateDebugKeystore: %w", &CommandError{Path: cmd.Path, Args: cmd.Args[1:], Output: out, Err: err})
 	}
 
-	return "", nil
+	return debugKeystore, nil
 }
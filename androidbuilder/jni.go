@@ -0,0 +1,38 @@
+package androidbuilder
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// JNIMangle escapes a fully qualified class name or a method name,
+// as specified for native method names by the JNI specification.
+func JNIMangle(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '.' || r == '/':
+			b.WriteByte('_')
+		case r == '_':
+			b.WriteString("_1")
+		case r == ';':
+			b.WriteString("_2")
+		case r == '[':
+			b.WriteString("_3")
+		case r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		default:
+			for _, c := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, "_0%04x", c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// JNIFunctionName returns the name of the native function implementing
+// method of class, where class is fully qualified e.g. "com.example.MainActivity".
+func JNIFunctionName(class, method string) string {
+	return "Java_" + JNIMangle(class) + "_" + JNIMangle(method)
+}
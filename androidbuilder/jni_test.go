@@ -0,0 +1,43 @@
+package androidbuilder
+
+import "testing"
+
+func TestJNIMangle(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"com.example.app", "com_example_app"},
+		{"com/example/app", "com_example_app"},
+		{"my_app", "my_1app"},
+		{"a;b", "a_2b"},
+		{"[I", "_3I"},
+		{"Main$Inner", "Main_00024Inner"},
+		{"café", "caf_000e9"},
+		// characters outside the BMP are escaped as utf-16 surrogate pairs
+		{"a😀", "a_0d83d_0de00"},
+	}
+
+	for _, tt := range tests {
+		if got := JNIMangle(tt.in); got != tt.want {
+			t.Errorf("JNIMangle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJNIFunctionName(t *testing.T) {
+	tests := []struct {
+		class, method, want string
+	}{
+		{"com.example.app.MainActivity", "greeter", "Java_com_example_app_MainActivity_greeter"},
+		{"com.example.my_app.MainActivity", "get_name", "Java_com_example_my_1app_MainActivity_get_1name"},
+		{"com.example.Main$Inner", "run", "Java_com_example_Main_00024Inner_run"},
+		{"com.example.Main$Inner$Deeper", "run", "Java_com_example_Main_00024Inner_00024Deeper_run"},
+		{"Main", "run", "Java_Main_run"},
+	}
+
+	for _, tt := range tests {
+		if got := JNIFunctionName(tt.class, tt.method); got != tt.want {
+			t.Errorf("JNIFunctionName(%q, %q) = %q, want %q", tt.class, tt.method, got, tt.want)
+		}
+	}
+}
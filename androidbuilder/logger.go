@@ -0,0 +1,99 @@
+package androidbuilder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+type LogLevel int
+
+const (
+	// LogQuiet prints nothing but the output of tools that failed.
+	LogQuiet LogLevel = iota - 1
+	// LogNormal also echoes commands before running them.
+	LogNormal
+	// LogVerbose also streams the output of every tool while it runs.
+	LogVerbose
+)
+
+// Logger controls what is printed while building and downloading, and where.
+// A nil or zero Logger logs at LogNormal to os.Stdout and os.Stderr.
+type Logger struct {
+	Level LogLevel
+
+	// Stdout receives echoed commands and, at LogVerbose, output of tools.
+	Stdout io.Writer
+	// Stderr receives output of failed tools and, at LogVerbose,
+	// error output of tools.
+	Stderr io.Writer
+}
+
+func (l *Logger) level() LogLevel {
+	if l == nil {
+		return LogNormal
+	}
+	return l.Level
+}
+
+func (l *Logger) stdout() io.Writer {
+	if l == nil || l.Stdout == nil {
+		return os.Stdout
+	}
+	return l.Stdout
+}
+
+func (l *Logger) stderr() io.Writer {
+	if l == nil || l.Stderr == nil {
+		return os.Stderr
+	}
+	return l.Stderr
+}
+
+// run echoes and runs cmd. Output of cmd is streamed at LogVerbose,
+// otherwise it is captured and written to stderr only if cmd fails.
+// Captured output is returned.
+func (l *Logger) run(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	if l.level() >= LogNormal {
+		fmt.Fprintln(l.stdout(), cmd.String())
+	}
+
+	if l.level() >= LogVerbose {
+		cmd.Stdout = l.stdout()
+		cmd.Stderr = l.stderr()
+		return nil, runContext(ctx, cmd)
+	}
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := runContext(ctx, cmd)
+	if err != nil {
+		l.stderr().Write(out.Bytes())
+	}
+	return out.Bytes(), err
+}
+
+type downloadOptions struct {
+	logger *Logger
+}
+
+type DownloadOption func(*downloadOptions)
+
+// Log output of sdkmanager via l.
+func DownloadOptLogger(l *Logger) DownloadOption {
+	return func(opts *downloadOptions) {
+		opts.logger = l
+	}
+}
+
+func newDownloadOptions(opts []DownloadOption) *downloadOptions {
+	o := &downloadOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -1,50 +1,264 @@
 package androidbuilder
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
+// HasNdk reports whether any ndk is installed in the sdk.
 func HasNdk(androidSdkRoot string) bool {
-	entries, err := os.ReadDir(androidSdkRoot)
-	if err != nil {
-		return false
+	return FindLatestVersionOfNdkInstalled(androidSdkRoot) != ""
+}
+
+// FindLatestVersionOfNdkInstalled returns the directory of the highest
+// version of ndk installed in "ndk/<version>", or in the legacy "ndk-bundle".
+func FindLatestVersionOfNdkInstalled(androidSdkRoot string) string {
+	var latest, latestVersion string
+
+	for _, dir := range installedNdks(androidSdkRoot) {
+		version := NdkRevision(dir)
+		if version == "" {
+			version = filepath.Base(dir)
+		}
+
+		if latest == "" || compareVersions(version, latestVersion) > 0 {
+			latest, latestVersion = dir, version
+		}
 	}
 
+	return latest
+}
+
+func installedNdks(androidSdkRoot string) []string {
+	var dirs []string
+
+	entries, _ := os.ReadDir(filepath.Join(androidSdkRoot, "ndk"))
 	for _, entry := range entries {
-		if entry.IsDir() && entry.Name() == "ndk" {
-			return true
+		if entry.IsDir() {
+			dirs = append(dirs, filepath.Join(androidSdkRoot, "ndk", entry.Name()))
 		}
 	}
 
-	return false
+	bundle := filepath.Join(androidSdkRoot, "ndk-bundle")
+	if info, err := os.Stat(bundle); err == nil && info.IsDir() {
+		dirs = append(dirs, bundle)
+	}
+
+	return dirs
 }
 
-func FindLatestVersionOfNdkInstalled(androidSdkRoot string) string {
-	entries, err := os.ReadDir(filepath.Join(androidSdkRoot, "ndk"))
+// NdkRevision reads "Pkg.Revision" from source.properties of the ndk,
+// e.g. "25.2.9519653". Returns "" if it can't be read.
+func NdkRevision(ndkDir string) string {
+	f, err := os.Open(filepath.Join(ndkDir, "source.properties"))
 	if err != nil {
 		return ""
 	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), "=")
+		if ok && strings.TrimSpace(key) == "Pkg.Revision" {
+			return strings.TrimSpace(value)
+		}
+	}
+
+	return ""
+}
+
+// FindNdkVersionInBuildGradle returns ndkVersion set in app/build.gradle
+// (or app/build.gradle.kts) of androidDir, "" if it is not set.
+func FindNdkVersionInBuildGradle(androidDir string) string {
+	for _, name := range []string{"build.gradle", "build.gradle.kts"} {
+		if v := ndkVersionInFile(filepath.Join(androidDir, "app", name)); v != "" {
+			return v
+		}
+	}
 
-	if len(entries) == 0 {
+	return ""
+}
+
+// ndkVersionInFile returns ndkVersion set in the gradle file at path, "" if it
+// is not set to a string literal or the file can't be read.
+func ndkVersionInFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
 		return ""
 	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		text := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(text, "ndkVersion") {
+			continue
+		}
+
+		// ndkVersion "25.2.9519653" or ndkVersion = "25.2.9519653",
+		// other expressions like rootProject.ext.ndkVersion can't be resolved
+		value := strings.TrimSpace(strings.TrimPrefix(text, "ndkVersion"))
+		value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			continue
+		}
+		end := strings.IndexByte(value[1:], value[0])
+		if end > 0 {
+			return value[1 : 1+end]
+		}
+	}
+
+	return ""
+}
+
+// compareVersions compares dot separated versions numerically,
+// e.g. "25.2.9519653" > "9.1.0", legacy revisions like "r21e" compare
+// by their major version
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "r"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "r"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x = leadingInt(as[i])
+		}
+		if i < len(bs) {
+			y = leadingInt(bs[i])
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// leadingInt parses the leading digits of s, "0-beta1" is 0
+func leadingInt(s string) int {
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			break
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
+
+type resolveNdkOptions struct {
+	version string
+
+	download     bool
+	downloadOpts []DownloadOption
+}
+
+type ResolveNdkOption func(*resolveNdkOptions)
+
+// Use ndk version, instead of ndkVersion from build.gradle.
+func ResolveNdkOptVersion(version string) ResolveNdkOption {
+	return func(opts *resolveNdkOptions) {
+		opts.version = version
+	}
+}
+
+// Install the pinned version if it is missing,
+// or the latest version if no ndk is installed.
+func ResolveNdkOptDownload(opts ...DownloadOption) ResolveNdkOption {
+	return func(o *resolveNdkOptions) {
+		o.download = true
+		o.downloadOpts = opts
+	}
+}
+
+// ResolveNdk finds the ndk to build with, in order of precedence:
+//
+//	the version passed via ResolveNdkOptVersion
+//	ndkVersion in app/build.gradle of androidDir
+//	ANDROID_NDK_HOME
+//	highest version installed in the sdk
+//
+// A pinned version is also found in "ndk-bundle" or ANDROID_NDK_HOME
+// if their revision matches.
+func ResolveNdk(ctx context.Context, androidSdkRoot, androidDir string, opts ...ResolveNdkOption) (string, error) {
+	o := &resolveNdkOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	version := o.version
+	if version == "" && androidDir != "" {
+		version = FindNdkVersionInBuildGradle(androidDir)
+	}
+	ndkHome := os.Getenv("ANDROID_NDK_HOME")
+
+	if version != "" {
+		candidates := installedNdks(androidSdkRoot)
+		if ndkHome != "" {
+			candidates = append(candidates, ndkHome)
+		}
+		for _, dir := range candidates {
+			if filepath.Base(dir) == version || NdkRevision(dir) == version {
+				return dir, nil
+			}
+		}
+
+		if !o.download {
+			return "", fmt.Errorf("ResolveNdk: %w: version %s is not installed in %s", ErrNdkNotFound, version, androidSdkRoot)
+		}
+
+		err := DownloadNdkContext(ctx, androidSdkRoot, version, o.downloadOpts...)
+		if err != nil {
+			return "", fmt.Errorf("ResolveNdk: %w", err)
+		}
+		return filepath.Join(androidSdkRoot, "ndk", version), nil
+	}
+
+	if ndkHome != "" {
+		_, err := os.Stat(ndkHome)
+		if err != nil {
+			return "", fmt.Errorf("ResolveNdk: %w: ANDROID_NDK_HOME: %v", ErrNdkNotFound, err)
+		}
+		return ndkHome, nil
+	}
+
+	if dir := FindLatestVersionOfNdkInstalled(androidSdkRoot); dir != "" {
+		return dir, nil
+	}
+
+	if !o.download {
+		return "", fmt.Errorf("ResolveNdk: %w in %s", ErrNdkNotFound, androidSdkRoot)
+	}
 
-	entry := entries[len(entries)-1]
-	dir := entry.Name()
+	latestVersion, err := FindLatestVersionOfSdkContext(ctx, "ndk", "", true)
+	if err != nil {
+		return "", fmt.Errorf("ResolveNdk: %w", err)
+	}
 
-	return filepath.Join(androidSdkRoot, "ndk", dir)
+	err = DownloadNdkContext(ctx, androidSdkRoot, latestVersion, o.downloadOpts...)
+	if err != nil {
+		return "", fmt.Errorf("ResolveNdk: %w", err)
+	}
+	return filepath.Join(androidSdkRoot, "ndk", latestVersion), nil
 }
 
 // ndkVersion should be "major.minor.micro" not "ndk;major.minor.micro"
 func DownloadNdk(androidSdkRoot, version string) error {
-	sdkmanager := filepath.Join(androidSdkRoot, "cmdline-tools", "latest", "bin", getName("sdkmanager"))
-	cmd := exec.Command(sdkmanager, "ndk;"+version)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	return DownloadNdkContext(context.Background(), androidSdkRoot, version)
+}
+
+// DownloadNdkContext is like DownloadNdk, when ctx is done sdkmanager is
+// killed and the partially installed ndk is removed.
+func DownloadNdkContext(ctx context.Context, androidSdkRoot, version string, opts ...DownloadOption) error {
+	options := newDownloadOptions(opts)
+
+	err := sdkmanagerInstall(ctx, options.logger, androidSdkRoot, "ndk;"+version, filepath.Join(androidSdkRoot, "ndk", version))
 	if err != nil {
 		return fmt.Errorf("DownloadNdk: %w", err)
 	}
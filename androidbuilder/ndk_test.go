@@ -0,0 +1,70 @@
+package androidbuilder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNdkVersionInFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"groovy", "android {\n    ndkVersion \"25.2.9519653\"\n}\n", "25.2.9519653"},
+		{"kotlin", "android {\n    ndkVersion = \"25.2.9519653\"\n}\n", "25.2.9519653"},
+		{"single quotes", "ndkVersion '21.4.7075529'\n", "21.4.7075529"},
+		{"trailing comment", "ndkVersion \"25.1.8937393\" // pinned\n", "25.1.8937393"},
+		{"trailing quoted comment", "ndkVersion '25.1.8937393' // \"pinned\"\n", "25.1.8937393"},
+		{"expression", "ndkVersion rootProject.ext.ndkVersion\n", ""},
+		{"expression then literal", "ndkVersion rootProject.ext.ndkVersion\nndkVersion \"23.1.7779620\"\n", "23.1.7779620"},
+		{"other property", "ndkVersionCode \"1\"\n", ""},
+		{"unterminated", "ndkVersion \"25.2.9519653\n", ""},
+		{"empty", "ndkVersion \"\"\n", ""},
+		{"not set", "android {\n    compileSdk 33\n}\n", ""},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "build.gradle")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := ndkVersionInFile(path); got != tt.want {
+				t.Errorf("ndkVersionInFile(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+
+	if got := ndkVersionInFile(filepath.Join(dir, "missing.gradle")); got != "" {
+		t.Errorf("ndkVersionInFile of a missing file = %q, want \"\"", got)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"25.2.9519653", "9.1.0", 1},
+		{"9.1.0", "25.2.9519653", -1},
+		{"25.2.9519653", "25.2.9519653", 0},
+		{"25.1.8937393", "25.2.9519653", -1},
+		{"25", "25.0.1", -1},
+		{"26.0.10404224-beta1", "26.0.10404224", 0},
+		{"r21e", "r20b", 1},
+		{"r21e", "22.1.7171670", -1},
+		{"r21e", "21", 0},
+		// ndk-bundle without source.properties is compared by its name
+		{"ndk-bundle", "21.4.7075529", -1},
+		{"ndk-bundle", "ndk-bundle", 0},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
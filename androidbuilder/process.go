@@ -0,0 +1,46 @@
+package androidbuilder
+
+import (
+	"context"
+	"os/exec"
+)
+
+// RunContext runs cmd, when ctx is done cmd is killed along with the
+// processes it started, e.g. compilers and linkers started by "go build",
+// and ctx.Err() is returned unless cmd exited by itself before that.
+func RunContext(ctx context.Context, cmd *exec.Cmd) error {
+	return runContext(ctx, cmd)
+}
+
+func runContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	setProcessGroup(cmd)
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	killed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = killProcessTree(cmd.Process)
+			killed <- true
+		case <-done:
+			killed <- false
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+
+	// a process that exited by itself before it was killed keeps its error
+	if <-killed && err != nil && !exitedByItself(err) {
+		return ctx.Err()
+	}
+	return err
+}
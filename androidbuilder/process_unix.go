@@ -0,0 +1,31 @@
+//go:build !windows
+
+package androidbuilder
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// start cmd in its own process group, so that the processes
+// it starts can be killed along with it
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func killProcessTree(p *os.Process) error {
+	// negative pid signals every process in the group
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+// exitedByItself reports whether err is the exit status of a process that
+// exited, rather than being killed by a signal
+func exitedByItself(err error) bool {
+	var ee *exec.ExitError
+	return errors.As(err, &ee) && ee.Exited()
+}
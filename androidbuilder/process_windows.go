@@ -0,0 +1,24 @@
+package androidbuilder
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessTree(p *os.Process) error {
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run()
+	if err != nil {
+		return p.Kill()
+	}
+	return nil
+}
+
+// exitedByItself reports whether err is the exit status of a process that
+// exited by itself, processes killed by taskkill exit with status 1 on
+// windows, so it can't be told apart
+func exitedByItself(err error) bool {
+	return false
+}
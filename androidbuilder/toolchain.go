@@ -0,0 +1,161 @@
+package androidbuilder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// NDKToolchain holds paths of the ndk llvm toolchain, for compiling
+// c code for an ABI and API level.
+type NDKToolchain struct {
+	NDKDir string
+	// Prebuilt is the host directory in "toolchains/llvm/prebuilt",
+	// e.g. "<ndk>/toolchains/llvm/prebuilt/linux-x86_64".
+	Prebuilt string
+
+	ABI      ABI
+	APILevel string
+
+	CC      string
+	CXX     string
+	AR      string
+	Strip   string
+	Objcopy string
+	Readelf string
+	Sysroot string
+}
+
+// NewNDKToolchain resolves the toolchain of ndkDir to build for abi,
+// targeting apiLevel (minSdkVersion).
+func NewNDKToolchain(ndkDir string, abi ABI, apiLevel string) (*NDKToolchain, error) {
+	prebuilt, err := FindNDKPrebuilt(ndkDir)
+	if err != nil {
+		return nil, err
+	}
+
+	bin := filepath.Join(prebuilt, "bin")
+
+	t := &NDKToolchain{
+		NDKDir:   ndkDir,
+		Prebuilt: prebuilt,
+		ABI:      abi,
+		APILevel: apiLevel,
+
+		CC:      filepath.Join(bin, getName("clang")),
+		CXX:     filepath.Join(bin, getName("clang++")),
+		AR:      filepath.Join(bin, getName("llvm-ar")),
+		Strip:   filepath.Join(bin, getName("llvm-strip")),
+		Objcopy: filepath.Join(bin, getName("llvm-objcopy")),
+		Readelf: filepath.Join(bin, getName("llvm-readelf")),
+		Sysroot: filepath.Join(prebuilt, "sysroot"),
+	}
+
+	_, err = os.Stat(t.CC)
+	if err != nil {
+		return nil, fmt.Errorf("NewNDKToolchain: %w: %v", ErrNdkToolchainNotFound, err)
+	}
+
+	return t, nil
+}
+
+// FindNDKPrebuilt finds the host directory in "toolchains/llvm/prebuilt"
+// of ndkDir. If there are several, the one for runtime.GOOS is picked,
+// e.g. "darwin-x86_64" which also runs on arm64 macs.
+func FindNDKPrebuilt(ndkDir string) (string, error) {
+	dir := filepath.Join(ndkDir, "toolchains", "llvm", "prebuilt")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("FindNDKPrebuilt: %w: %v", ErrNdkToolchainNotFound, err)
+	}
+
+	var hosts []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			hosts = append(hosts, entry.Name())
+		}
+	}
+
+	for _, host := range hosts {
+		if strings.HasPrefix(host, runtime.GOOS+"-") {
+			return filepath.Join(dir, host), nil
+		}
+	}
+
+	if len(hosts) == 1 {
+		return filepath.Join(dir, hosts[0]), nil
+	}
+
+	return "", fmt.Errorf("FindNDKPrebuilt: %w: no prebuilt toolchain for GOOS=%s in %s", ErrNdkToolchainNotFound, runtime.GOOS, dir)
+}
+
+// Flags returns the flags that select the target, API level and sysroot,
+// they are needed by every compiler and linker invocation.
+func (t *NDKToolchain) Flags() []string {
+	return []string{
+		"--target=" + t.ABI.Target + t.APILevel,
+		"--gcc-toolchain=" + t.Prebuilt,
+		"--sysroot=" + t.Sysroot,
+	}
+}
+
+// CCCommand returns CC with Flags, in the form expected by the CC
+// environment variable of the go command.
+func (t *NDKToolchain) CCCommand() string {
+	return strings.Join(append([]string{t.CC}, t.Flags()...), " ")
+}
+
+// CXXCommand is like CCCommand for CXX.
+func (t *NDKToolchain) CXXCommand() string {
+	return strings.Join(append([]string{t.CXX}, t.Flags()...), " ")
+}
+
+// SystemLibraries returns file names of the libraries android provides to
+// apps at APILevel, e.g. "libc.so" and "liblog.so". If the ndk doesn't have
+// stubs for APILevel the closest lower level is used, or the lowest one.
+func (t *NDKToolchain) SystemLibraries() ([]string, error) {
+	triple := strings.Replace(t.ABI.Target, "-none", "", 1)
+	if strings.HasPrefix(triple, "armv7") {
+		triple = "arm" + strings.TrimPrefix(strings.TrimPrefix(triple, "armv7a"), "armv7")
+	}
+	dir := filepath.Join(t.Sysroot, "usr", "lib", triple)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("SystemLibraries: %w: %v", ErrNdkToolchainNotFound, err)
+	}
+
+	want, _ := strconv.Atoi(t.APILevel)
+	level := -1
+	for _, entry := range entries {
+		l, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		switch {
+		case level == -1,
+			l <= want && (l > level || level > want),
+			l > want && level > want && l < level:
+			level = l
+		}
+	}
+	if level == -1 {
+		return nil, fmt.Errorf("SystemLibraries: %w: no api levels in %s", ErrNdkToolchainNotFound, dir)
+	}
+
+	entries, err = os.ReadDir(filepath.Join(dir, strconv.Itoa(level)))
+	if err != nil {
+		return nil, fmt.Errorf("SystemLibraries: %w", err)
+	}
+
+	var libs []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".so") {
+			libs = append(libs, entry.Name())
+		}
+	}
+	return libs, nil
+}
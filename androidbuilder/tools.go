@@ -30,6 +30,18 @@ func getName(tool string) string {
 		return "gradlew.bat"
 	case "adb":
 		return "adb.exe"
+	case "clang":
+		return "clang.exe"
+	case "clang++":
+		return "clang++.exe"
+	case "llvm-ar":
+		return "llvm-ar.exe"
+	case "llvm-strip":
+		return "llvm-strip.exe"
+	case "llvm-objcopy":
+		return "llvm-objcopy.exe"
+	case "llvm-readelf":
+		return "llvm-readelf.exe"
 
 	default:
 		panic("unreachable")
@@ -1,12 +1,11 @@
 package androidbuilder
 
 import (
-	"archive/zip"
 	"bufio"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -72,6 +71,70 @@ func GetPackageAndActivityFromManifest(manifestFile string) (pkgName string, act
 	return "", "", errors.New("unable to find")
 }
 
+// NativeActivity is an activity of the manifest implemented in native code,
+// android.app.NativeActivity or a subclass naming its library with
+// android.app.lib_name meta-data
+type NativeActivity struct {
+	Name string
+	// library loaded for the activity, "main" if not set
+	LibName string
+	// function called to create the activity, "ANativeActivity_onCreate"
+	// if not set
+	FuncName string
+}
+
+func GetNativeActivitiesFromManifest(manifestFile string) ([]NativeActivity, error) {
+	var manifest struct {
+		XMLName     xml.Name `xml:"manifest"`
+		Application struct {
+			Activity []struct {
+				Name     string `xml:"name,attr"`
+				MetaData []struct {
+					Name  string `xml:"name,attr"`
+					Value string `xml:"value,attr"`
+				} `xml:"meta-data"`
+			} `xml:"activity"`
+		} `xml:"application"`
+	}
+
+	f, err := os.Open(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("getNativeActivitiesFromManifest: %w", err)
+	}
+	defer f.Close()
+
+	err = xml.NewDecoder(f).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("getNativeActivitiesFromManifest: %w", err)
+	}
+
+	var activities []NativeActivity
+	for _, activity := range manifest.Application.Activity {
+		a := NativeActivity{Name: activity.Name}
+		for _, m := range activity.MetaData {
+			switch m.Name {
+			case "android.app.lib_name":
+				a.LibName = m.Value
+			case "android.app.func_name":
+				a.FuncName = m.Value
+			}
+		}
+
+		if a.LibName == "" && activity.Name != "android.app.NativeActivity" {
+			continue
+		}
+		if a.LibName == "" {
+			a.LibName = "main"
+		}
+		if a.FuncName == "" {
+			a.FuncName = "ANativeActivity_onCreate"
+		}
+		activities = append(activities, a)
+	}
+
+	return activities, nil
+}
+
 func FindMinSdkAndTargetSdk(androidDir string) (string, string, error) {
 	// Try parsing AndroidManifest.xml
 	{
@@ -140,99 +203,15 @@ func FindMinSdkAndTargetSdk(androidDir string) (string, string, error) {
 	return "", "", errors.New("unable to find minSdk and targetSdk")
 }
 
-func addFilesToZip(zipPath string, files map[string]string) error {
-	err := os.Rename(zipPath, zipPath+".old")
-	if err != nil {
-		return err
-	}
-
-	z, err := zip.OpenReader(zipPath + ".old")
-	if err != nil {
-		return err
-	}
-	defer z.Close()
-
-	f, err := os.Create(zipPath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	w := zip.NewWriter(f)
-	defer w.Close()
-
-	for _, file := range z.File {
-		err = func(file *zip.File, w *zip.Writer) error {
-			src, err := file.Open()
-			if err != nil {
-				return err
-			}
-			defer src.Close()
-
-			fh, err := zip.FileInfoHeader(file.FileInfo())
-			if err != nil {
-				return err
-			}
-			fh.Name = file.Name
-
-			dst, err := w.CreateHeader(fh)
-			if err != nil {
-				return err
-			}
-
-			_, err = io.Copy(dst, src)
-			if err != nil {
-				return err
-			}
-
-			return nil
-		}(file, w)
-		if err != nil {
-			return err
-		}
-	}
-
-	for pathOnHost, pathInZip := range files {
-		err = func() error {
-			src, err := os.Open(pathOnHost)
-			if err != nil {
-				return err
-			}
-			defer src.Close()
-
-			info, err := src.Stat()
-			if err != nil {
-				return err
-			}
-
-			fh, err := zip.FileInfoHeader(info)
-			if err != nil {
-				return err
-			}
-			fh.Name = pathInZip
-
-			dst, err := w.CreateHeader(fh)
-			if err != nil {
-				return err
-			}
-
-			_, err = io.Copy(dst, src)
-			if err != nil {
-				return err
-			}
-			return nil
-		}()
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 // only supports "build-tools" & "ndk"
 func FindLatestVersionOfSdk(sdk string, targetSdkVersion string, skipPreview bool) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://dl.google.com/android/repository/repository2-1.xml", nil)
+	return FindLatestVersionOfSdkContext(context.Background(), sdk, targetSdkVersion, skipPreview)
+}
+
+// FindLatestVersionOfSdkContext is like FindLatestVersionOfSdk, the request
+// is aborted when ctx is done.
+func FindLatestVersionOfSdkContext(ctx context.Context, sdk string, targetSdkVersion string, skipPreview bool) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://dl.google.com/android/repository/repository2-1.xml", nil)
 	if err != nil {
 		return "", fmt.Errorf("findLatestVersionOfSdk: %w", err)
 	}
@@ -287,3 +266,12 @@ func FindLatestVersionOfSdk(sdk string, targetSdkVersion string, skipPreview boo
 
 	return "", errors.New("findLatestVersionOfSdk: unable to find latest version for " + sdk)
 }
+
+func contains[T comparable](s []T, e T) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package androidbuilder
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// alignments of uncompressed zip entries, same as zipalign -P 16
+const (
+	zipAlignment = 4
+	// native libraries are mapped straight from the apk
+	zipLibAlignment = PageSize16K
+)
+
+// extra field zipalign pads local headers with
+const zipAlignmentExtraID = 0xd935
+
+// writeAlignedZip writes dst with the entries of the zip src followed by
+// files (PathOnHost -> PathInZip). Uncompressed entries are aligned to 4
+// bytes, native libraries are stored uncompressed and aligned to 16 KB,
+// other files are compressed.
+// dst is removed if it can't be completely written, e.g. when ctx is done.
+func writeAlignedZip(ctx context.Context, src, dst string, files map[string]string) (err error) {
+	z, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := f.Close()
+		if err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	cw := &countWriter{w: f}
+	w := zip.NewWriter(cw)
+
+	for _, file := range z.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err = copyAlignedEntry(w, cw, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	// sorted, so that the apk is reproducible
+	pathsOnHost := make([]string, 0, len(files))
+	for pathOnHost := range files {
+		pathsOnHost = append(pathsOnHost, pathOnHost)
+	}
+	sort.Strings(pathsOnHost)
+
+	for _, pathOnHost := range pathsOnHost {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err = addAlignedFile(w, cw, pathOnHost, files[pathOnHost])
+		if err != nil {
+			return err
+		}
+	}
+
+	// writes the central directory
+	return w.Close()
+}
+
+func copyAlignedEntry(w *zip.Writer, cw *countWriter, file *zip.File) error {
+	src, err := file.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	fh := file.FileHeader
+	fh.Extra = withoutAlignmentExtra(fh.Extra)
+	// sizes and crc go in the local header instead of a data descriptor,
+	// which zip.Writer would only write when the next entry is created,
+	// after its alignment was computed
+	fh.Flags &^= 0x8
+	if fh.Method == zip.Store {
+		err = alignHeader(w, cw, &fh, zipAlignment)
+		if err != nil {
+			return err
+		}
+	}
+
+	dst, err := w.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func addAlignedFile(w *zip.Writer, cw *countWriter, pathOnHost, pathInZip string) error {
+	info, err := os.Stat(pathOnHost)
+	if err != nil {
+		return err
+	}
+
+	fh, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	fh.Name = pathInZip
+
+	// entries are written raw with sizes and crc in the local header, so
+	// that no data descriptor is pending when the next entry is aligned,
+	// and native libraries can be mapped without reading the zip
+	data, err := os.ReadFile(pathOnHost)
+	if err != nil {
+		return err
+	}
+	fh.CRC32 = crc32.ChecksumIEEE(data)
+	fh.UncompressedSize64 = uint64(len(data))
+
+	if path.Ext(pathInZip) == ".so" {
+		fh.Method = zip.Store
+		fh.CompressedSize64 = uint64(len(data))
+
+		err = alignHeader(w, cw, fh, zipLibAlignment)
+		if err != nil {
+			return err
+		}
+	} else {
+		var b bytes.Buffer
+		fw, err := flate.NewWriter(&b, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		if err != nil {
+			return err
+		}
+		err = fw.Close()
+		if err != nil {
+			return err
+		}
+
+		fh.Method = zip.Deflate
+		fh.CompressedSize64 = uint64(b.Len())
+		data = b.Bytes()
+	}
+
+	dst, err := w.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(data)
+	return err
+}
+
+// alignHeader pads the extra field of fh, so that data of the entry
+// written next starts at a multiple of alignment
+func alignHeader(w *zip.Writer, cw *countWriter, fh *zip.FileHeader, alignment int64) error {
+	// flush, so that cw.n is the offset of the local header
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	// zip.Writer would add an extended timestamp to the extra field,
+	// the dos time is kept in ModifiedDate and ModifiedTime
+	fh.Modified = time.Time{}
+
+	const (
+		localHeaderLen = 30
+		// id, size and alignment of the padding extra field
+		paddingHeaderLen = 6
+	)
+
+	dataOff := cw.n + localHeaderLen + int64(len(fh.Name)) + int64(len(fh.Extra)) + paddingHeaderLen
+	padding := (alignment - dataOff%alignment) % alignment
+
+	extra := make([]byte, paddingHeaderLen+padding)
+	binary.LittleEndian.PutUint16(extra[0:], zipAlignmentExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], uint16(2+padding))
+	binary.LittleEndian.PutUint16(extra[4:], uint16(alignment))
+	fh.Extra = append(fh.Extra, extra...)
+
+	return nil
+}
+
+// withoutAlignmentExtra removes padding of a previous alignment
+func withoutAlignmentExtra(extra []byte) []byte {
+	var out []byte
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		if id != zipAlignmentExtraID {
+			out = append(out, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+	return out
+}
+
+// countWriter counts bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
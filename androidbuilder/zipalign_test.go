@@ -0,0 +1,130 @@
+package androidbuilder
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteAlignedZip(t *testing.T) {
+	dir := t.TempDir()
+
+	// zip.Writer.CreateHeader writes sizes and crc of every entry in a data
+	// descriptor following its data, like the unaligned apks of aapt2
+	src := filepath.Join(dir, "unaligned.apk")
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	srcEntries := []struct {
+		name    string
+		method  uint16
+		content string
+	}{
+		{"AndroidManifest.xml", zip.Deflate, strings.Repeat("manifest", 100)},
+		{"resources.arsc", zip.Store, "arsc"},
+		{"res/raw/a.txt", zip.Store, "abc"},
+		{"res/raw/b.txt", zip.Deflate, "defgh"},
+	}
+	for _, e := range srcEntries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hostFiles := map[string]string{
+		"classes.dex":                      strings.Repeat("dex", 1000),
+		"lib/arm64-v8a/libmain.so":         strings.Repeat("\x7fELF", 5000),
+		"lib/arm64-v8a/libother.so":        "odd size library",
+		"lib/armeabi-v7a/libmain.so":       strings.Repeat("x", 12345),
+		"assets/readme.txt":                "text",
+		"lib/armeabi-v7a/libc++_shared.so": "c++",
+	}
+	files := map[string]string{}
+	for name, content := range hostFiles {
+		file := filepath.Join(dir, "host", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files[file] = name
+	}
+
+	dst := filepath.Join(dir, "aligned.apk")
+	if err := writeAlignedZip(context.Background(), src, dst, files); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.OpenReader(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+
+	want := map[string]string{}
+	for _, e := range srcEntries {
+		want[e.name] = e.content
+	}
+	for name, content := range hostFiles {
+		want[name] = content
+	}
+	if len(z.File) != len(want) {
+		t.Errorf("aligned zip has %d entries, want %d", len(z.File), len(want))
+	}
+
+	for _, f := range z.File {
+		off, err := f.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case strings.HasSuffix(f.Name, ".so"):
+			if f.Method != zip.Store {
+				t.Errorf("%s is compressed, want stored", f.Name)
+			}
+			if off%zipLibAlignment != 0 {
+				t.Errorf("data of %s at offset %d, want a multiple of %d", f.Name, off, zipLibAlignment)
+			}
+		case f.Method == zip.Store:
+			if off%zipAlignment != 0 {
+				t.Errorf("data of %s at offset %d, want a multiple of %d", f.Name, off, zipAlignment)
+			}
+		}
+
+		if f.Name == "classes.dex" && f.Method != zip.Deflate {
+			t.Errorf("classes.dex is stored, want compressed")
+		}
+		if f.Flags&0x8 != 0 {
+			t.Errorf("%s has a data descriptor", f.Name)
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		if string(content) != want[f.Name] {
+			t.Errorf("content of %s changed", f.Name)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// keys accepted by -abi and "abi <goarch>" blocks of tsukurufile
+var abiKeys = []string{"name", "target", "goarm", "goamd64", "tags", "ldflags", "cgo_cflags", "cgo_ldflags", "env"}
+
+// abiSettings holds "<goarch>.<key>=<value>" settings, from tsukurufile
+// followed by the ones from -abi
+type abiSettings []string
+
+func (s *abiSettings) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, " ")
+}
+
+func (s *abiSettings) Set(v string) error {
+	_, _, _, err := parseABISetting(v)
+	if err != nil {
+		return err
+	}
+
+	*s = append(*s, v)
+	return nil
+}
+
+func parseABISetting(s string) (goarch, key, value string, err error) {
+	setting, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return "", "", "", errors.New("expected <goarch>.<key>=<value>, got " + s)
+	}
+
+	goarch, key, ok = strings.Cut(strings.TrimSpace(setting), ".")
+	if !ok || goarch == "" {
+		return "", "", "", errors.New("expected <goarch>.<key>=<value>, got " + s)
+	}
+
+	if !contains(abiKeys, key) {
+		return "", "", "", fmt.Errorf("unknown abi setting %q, expected one of %s", key, strings.Join(abiKeys, ", "))
+	}
+
+	return goarch, key, strings.TrimSpace(value), nil
+}
+
+// overrideABISettings returns configured followed by flags, without the
+// configured settings whose goarch and key are also set by flags, so a
+// setting from -abi replaces the one from tsukurufile instead of being
+// added to it
+func overrideABISettings(configured, flags []string) []string {
+	var set []string
+	for _, s := range flags {
+		goarch, key, _, err := parseABISetting(s)
+		if err == nil {
+			set = append(set, goarch+"."+key)
+		}
+	}
+
+	settings := make([]string, 0, len(configured)+len(flags))
+	for _, s := range configured {
+		goarch, key, _, err := parseABISetting(s)
+		if err == nil && contains(set, goarch+"."+key) {
+			continue
+		}
+		settings = append(settings, s)
+	}
+	return append(settings, flags...)
+}
+
+// configuredABIs applies settings to androidbuilder.DefaultABIs,
+// settings for a GOARCH not in defaults add a new ABI which needs
+// at least name and target
+func configuredABIs(settings []string) ([]androidbuilder.ABI, error) {
+	abis := androidbuilder.DefaultABIs()
+
+	for _, s := range settings {
+		goarch, key, value, err := parseABISetting(s)
+		if err != nil {
+			return nil, usageError("-abi: %w", err)
+		}
+
+		i := -1
+		for j := range abis {
+			if abis[j].GOARCH == goarch {
+				i = j
+			}
+		}
+		if i == -1 {
+			abis = append(abis, androidbuilder.ABI{GOARCH: goarch})
+			i = len(abis) - 1
+		}
+		abi := &abis[i]
+
+		switch key {
+		case "name":
+			abi.Name = value
+		case "target":
+			abi.Target = value
+		case "goarm":
+			abi.GOARM = value
+		case "goamd64":
+			abi.GOAMD64 = value
+		case "tags":
+			abi.Tags = append(abi.Tags, strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })...)
+		case "ldflags":
+			abi.Ldflags = strings.TrimSpace(abi.Ldflags + " " + value)
+		case "cgo_cflags":
+			abi.CgoCFlags = strings.TrimSpace(abi.CgoCFlags + " " + value)
+		case "cgo_ldflags":
+			abi.CgoLDFlags = strings.TrimSpace(abi.CgoLDFlags + " " + value)
+		case "env":
+			if !strings.Contains(value, "=") {
+				return nil, usageError("-abi: expected %s.env=KEY=value, got %s", goarch, s)
+			}
+			abi.Env = append(abi.Env, value)
+		}
+	}
+
+	for _, abi := range abis {
+		if abi.Name == "" || abi.Target == "" {
+			return nil, usageError("-abi: GOARCH=%s is not a known android abi, set its name and target", abi.GOARCH)
+		}
+	}
+
+	return abis, nil
+}
@@ -1,227 +1,424 @@
 package main
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"go/build"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/rajveermalviya/tsukuru/androidbuilder"
 )
 
-func buildAndroid(mainPackagePath string, targetType string) string {
-	minSdk, _, err := androidbuilder.FindMinSdkAndTargetSdk(androidDir)
+func buildAndroid(ctx context.Context, mainPackagePath string, targetType string) (string, error) {
+	abis, err := configuredABIs(abiFlags)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	androidSdkRoot, _, err := androidbuilder.GetAndroidSdkRoot()
+	libs, err := androidLibraries(mainPackagePath)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	if !androidbuilder.HasNdk(androidSdkRoot) && download {
-		latestVersion, err := androidbuilder.FindLatestVersionOfSdk(
-			"ndk",
-			"", /* ignored for ndk */
-			true,
-		)
-		if err != nil {
-			panic(err)
-		}
-
-		err = androidbuilder.DownloadNdk(androidSdkRoot, latestVersion)
-		if err != nil {
-			panic(err)
-		}
+	if !contains(androidBuildModes, buildMode) {
+		return "", usageError("invalid -buildmode %q, expected one of %s", buildMode, strings.Join(androidBuildModes, ", "))
 	}
-
-	ndkDir := androidbuilder.FindLatestVersionOfNdkInstalled(androidSdkRoot)
-	if ndkDir == "" {
-		panic("unable to find ndk dir in " + androidSdkRoot)
+	archive := buildMode == "c-archive"
+	if archive && androidBackend == "custom" {
+		return "", usageError("custom backend doesn't support -buildmode=c-archive, archives are linked by externalNativeBuild of gradle")
 	}
 
-	type abiForCompiler struct {
-		abi    string
-		target string
+	minSdk, _, err := androidbuilder.FindMinSdkAndTargetSdk(androidDir)
+	if err != nil {
+		return "", err
 	}
 
-	goarchesSlice := strings.Split(goarches, ",")
-
-	abis := map[string]abiForCompiler{
-		"arm": {
-			abi:    "armeabi-v7a",
-			target: "armv7-none-linux-androideabi",
-		},
-		"arm64": {
-			abi:    "arm64-v8a",
-			target: "aarch64-none-linux-android",
-		},
-		"386": {
-			abi:    "x86",
-			target: "i686-none-linux-android",
-		},
-		"amd64": {
-			abi:    "x86_64",
-			target: "x86_64-none-linux-android",
-		},
+	androidSdkRoot, _, err := androidbuilder.GetAndroidSdkRoot()
+	if err != nil {
+		return "", err
 	}
 
-	if release {
-		ldflags += " -s -w"
+	ndkDir, err := androidbuilder.ResolveNdk(ctx, androidSdkRoot, androidDir, ndkOptions()...)
+	if err != nil {
+		return "", err
 	}
 
-	toolchainOS := ""
-	switch runtime.GOOS {
-	case "windows":
-		toolchainOS = "windows-x86_64"
-	case "darwin":
-		toolchainOS = "darwin-x86_64"
-	case "linux":
-		toolchainOS = "linux-x86_64"
-	default:
-		panic("invalid GOOS")
-	}
+	goarchesSlice := strings.Split(goarches, ",")
 
-	for goarch, abi := range abis {
-		libPath := filepath.Join(androidDir, "app", "src", "main", "jniLibs", abi.abi, "lib"+libName+".so")
-		_ = os.Remove(libPath)
+	// inputs shared by every GOARCH, -a forces a rebuild same as -force
+	var fingerprintBase []string
+	if !force && !a {
+		fingerprintBase, err = goBuildFingerprintBase(ndkDir)
+		if err != nil {
+			return "", err
+		}
+	}
 
+	var (
+		jobs    []goBuildJob
+		strip   []stripJob
+		shipped []shippedLibrary
+	)
+	for _, abi := range abis {
 		// skip GOARCH values that are not in user allowed list
-		if !contains(goarchesSlice, goarch) {
+		if !contains(goarchesSlice, abi.GOARCH) {
+			for _, lib := range libs {
+				removeSharedLibrary(abi, lib)
+				_ = os.Remove(filepath.Join(goLibsDir(), abi.Name, "lib"+lib.name+".a"))
+				_ = os.Remove(filepath.Join(goLibsDir(), abi.Name, "lib"+lib.name+".h"))
+			}
 			continue
 		}
 
-		cc := filepath.Join(ndkDir, "toolchains", "llvm", "prebuilt", toolchainOS, "bin", "clang")
-		cxx := cc + "++"
+		toolchain, err := androidbuilder.NewNDKToolchain(ndkDir, abi, minSdk)
+		if err != nil {
+			return "", err
+		}
 
-		gccToolchain := filepath.Join(ndkDir, "toolchains", "llvm", "prebuilt", toolchainOS)
-		sysroot := filepath.Join(ndkDir, "toolchains", "llvm", "prebuilt", toolchainOS, "sysroot")
+		for _, lib := range libs {
+			job, stripped := androidBuildJob(abi, toolchain, lib)
+			if len(libs) > 1 {
+				job.lib = lib.file()
+			}
+			if fingerprintBase != nil {
+				job.fingerprintBase = fingerprintBase
+				job.fingerprintFile = filepath.Join(fingerprintsDir, "lib"+lib.name+"-"+abi.GOARCH)
+			}
+			jobs = append(jobs, job)
 
-		ccEnv := cc + " --target=" + abi.target + minSdk + " --gcc-toolchain=" + gccToolchain + " --sysroot=" + sysroot
-		cxxEnv := cxx + " --target=" + abi.target + minSdk + " --gcc-toolchain=" + gccToolchain + " --sysroot=" + sysroot
+			if archive {
+				// the go runtime would be loaded twice
+				removeSharedLibrary(abi, lib)
+				continue
+			}
 
-		args := []string{
-			"build",
-			"-trimpath",
-			"-buildmode", "c-shared",
+			if release {
+				strip = append(strip, stripped)
+			}
+			shipped = append(shipped, shippedLibrary{path: stripped.output, toolchain: toolchain})
 		}
-		if ldflags != "" {
-			args = append(args, "-ldflags", ldflags)
+	}
+
+	// keep the order of -goarches for readable logs
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return indexOf(goarchesSlice, jobs[i].goarch) < indexOf(goarchesSlice, jobs[j].goarch)
+	})
+
+	err = runGoBuilds(ctx, jobs, parallel)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case archive:
+		err = writeArchiveSnippets(libs)
+		if err != nil {
+			return "", err
 		}
-		if x {
-			args = append(args, "-x")
+
+	default:
+		for _, job := range jobs {
+			_ = os.Remove(strings.TrimSuffix(job.output, ".so") + ".h")
 		}
-		if a {
-			args = append(args, "-a")
+
+		if release {
+			err = stripLibraries(ctx, strip)
+			if err != nil {
+				return "", err
+			}
 		}
-		if race {
-			args = append(args, "-race")
+
+		err = checkLibraries(shipped)
+		if err != nil {
+			return "", err
 		}
-		if tags != "" {
-			args = append(args, "-tags", tags)
+
+		err = checkBuiltBindings(libs, shipped)
+		if err != nil {
+			return "", err
 		}
-		args = append(args,
-			"-o", libPath,
-			mainPackagePath,
-		)
+	}
 
-		cmd := exec.Command("go", args...)
-		cmd.Env = append(
-			os.Environ(),
-			"CGO_ENABLED=1",
-			"GOOS=android",
-			"GOARCH="+goarch,
-			"CC="+ccEnv,
-			"CXX="+cxxEnv,
+	// skip packaging if nothing in android directory changed since last build,
+	// jniLibs are part of the android directory, -a repackages same as -force
+	var packageFingerprint string
+	packageFingerprintFile := filepath.Join(fingerprintsDir, "package-"+targetType)
+	if !force && !a {
+		packageFingerprint, err = androidDirFingerprint(androidDir,
+			androidBackend,
+			targetType,
+			strconv.FormatBool(release),
 		)
-		if goarch == "arm" {
-			cmd.Env = append(cmd.Env, "GOARM=7")
-		}
-		fmt.Println(cmd.String())
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
-		err := cmd.Run()
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 
-		_ = os.Remove(filepath.Join(androidDir, "app", "src", "main", "jniLibs", abi.abi, "lib"+libName+".h"))
+		if apk, ok := upToDate(packageFingerprintFile, packageFingerprint); ok {
+			info("Nothing changed, skipping packaging")
+			fmt.Println("Built "+targetType+" available at:", apk)
+			return apk, emitArtifact(apk, targetType)
+		}
 	}
 
 	var apk string
 	switch androidBackend {
 	case "gradle":
-		apk = gradleBuildAndroid(targetType)
+		apk, err = gradleBuildAndroid(ctx, targetType)
 	case "custom":
-		apk = customBuildAndroid(targetType)
+		apk, err = customBuildAndroid(ctx, targetType)
 	default:
-		panic("invalid backend")
+		err = usageError("invalid android backend %q", androidBackend)
+	}
+	if err != nil {
+		_ = os.Remove(packageFingerprintFile)
+		return "", err
+	}
+
+	if packageFingerprint != "" {
+		err = writeFingerprint(packageFingerprintFile, packageFingerprint, apk)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	fmt.Println("Built apk available at:", apk)
-	return apk
+	fmt.Println("Built "+targetType+" available at:", apk)
+	return apk, emitArtifact(apk, targetType)
 }
 
-func customBuildAndroid(targetType string) string {
-	if targetType == "appbundle" {
-		panic("custom backend doesn't support building appbundle")
+// androidBuildJob returns the go build of lib for abi, for release builds
+// of shared libraries the returned stripJob writes the shipped copy
+func androidBuildJob(abi androidbuilder.ABI, toolchain *androidbuilder.NDKToolchain, lib goLibrary) (goBuildJob, stripJob) {
+	libPath := filepath.Join(androidDir, "app", "src", "main", "jniLibs", abi.Name, lib.file())
+	symbolsPath := filepath.Join(symbolsDir, abi.Name, lib.file())
+
+	args := []string{
+		"build",
+		"-trimpath",
+		"-buildmode", buildMode,
 	}
+	flags, tags := androidGoFlags(abi)
+	args = append(args, flags...)
+
+	// release builds keep the unstripped library for symbolizing crashes,
+	// and ship a stripped copy of it
+	output := libPath
+	switch {
+	case buildMode == "c-archive":
+		output = filepath.Join(goLibsDir(), abi.Name, "lib"+lib.name+".a")
+	case release:
+		output = symbolsPath
+	}
+
+	args = append(args,
+		"-o", output,
+		lib.pkg,
+	)
 
-	b, err := androidbuilder.NewCustomBuilder(androidDir, download)
+	env := androidGoEnv(abi, toolchain)
+
+	job := goBuildJob{
+		goarch: abi.GOARCH,
+		pkg:    lib.pkg,
+		output: output,
+		tags:   tags,
+		args:   args,
+		env:    env,
+	}
+
+	return job, stripJob{
+		abi:    abi.Name,
+		strip:  toolchain.Strip,
+		input:  symbolsPath,
+		output: libPath,
+	}
+}
+
+// androidGoFlags returns flags of go build and go test for abi, along
+// with the build tags passed in them
+func androidGoFlags(abi androidbuilder.ABI) ([]string, string) {
+	// devices with 16 KB pages need LOAD segments aligned to 16 KB,
+	// -extldflags of -ldflags or abi settings override it
+	pageSize := "-extldflags=-Wl,-z,max-page-size=" + strconv.Itoa(androidbuilder.PageSize16K)
+	args := []string{"-ldflags", strings.TrimSpace(pageSize + " " + ldflags + " " + abi.Ldflags)}
+	if x {
+		args = append(args, "-x")
+	}
+	if a {
+		args = append(args, "-a")
+	}
+	if race {
+		args = append(args, "-race")
+	}
+	tags := abi.BuildTags(tags)
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	return args, tags
+}
+
+// androidGoEnv returns the environment of go commands building for abi
+// with toolchain
+func androidGoEnv(abi androidbuilder.ABI, toolchain *androidbuilder.NDKToolchain) []string {
+	env := []string{
+		"CGO_ENABLED=1",
+		"GOOS=android",
+		"CC=" + toolchain.CCCommand(),
+		"CXX=" + toolchain.CXXCommand(),
+	}
+	return append(env, abi.GoEnv()...)
+}
+
+// removeSharedLibrary removes lib built for abi from jniLibs and symbolsDir
+func removeSharedLibrary(abi androidbuilder.ABI, lib goLibrary) {
+	_ = os.Remove(filepath.Join(androidDir, "app", "src", "main", "jniLibs", abi.Name, lib.file()))
+	_ = os.Remove(filepath.Join(symbolsDir, abi.Name, lib.file()))
+}
+
+// goLibrary is a Go package built into lib<name>.so
+type goLibrary struct {
+	pkg  string
+	name string
+}
+
+func (l goLibrary) file() string {
+	return "lib" + l.name + ".so"
+}
+
+// androidLibraries returns the main package built into lib<libname>.so,
+// followed by the packages from -libs
+func androidLibraries(mainPackagePath string) ([]goLibrary, error) {
+	out := []goLibrary{{pkg: mainPackagePath, name: libName}}
+
+	wd, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	for _, pair := range strings.Split(libs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		pkg, name, ok := strings.Cut(pair, "=")
+		pkg, name = strings.TrimSpace(pkg), strings.TrimSpace(name)
+		if !ok || pkg == "" || name == "" {
+			return nil, usageError("-libs: expected <package>=<libname>, got %s", pair)
+		}
+
+		for _, lib := range out {
+			if lib.name == name {
+				return nil, usageError("-libs: lib%s.so is built more than once", name)
+			}
+		}
+
+		// packages from tsukurufile are already resolved to directories
+		if !filepath.IsAbs(pkg) {
+			p, err := build.Import(pkg, wd, build.FindOnly)
+			if err != nil {
+				return nil, usageError("-libs: %w", err)
+			}
+			pkg = p.Dir
+		}
+
+		out = append(out, goLibrary{pkg: pkg, name: name})
+	}
+
+	return out, nil
+}
+
+// libPackages returns the packages of libs
+func libPackages(libs []goLibrary) []string {
+	pkgs := make([]string, len(libs))
+	for i, lib := range libs {
+		pkgs[i] = lib.pkg
+	}
+	return pkgs
+}
+
+// ndkOptions returns the options for androidbuilder.ResolveNdk
+// from -ndkversion and -download
+func ndkOptions() []androidbuilder.ResolveNdkOption {
+	var opts []androidbuilder.ResolveNdkOption
+	if ndkVersion != "" {
+		opts = append(opts, androidbuilder.ResolveNdkOptVersion(ndkVersion))
+	}
+	if download {
+		opts = append(opts, androidbuilder.ResolveNdkOptDownload(androidbuilder.DownloadOptLogger(logger())))
+	}
+	return opts
+}
+
+func customBuildAndroid(ctx context.Context, targetType string) (string, error) {
+	if targetType == "appbundle" {
+		return "", usageError("custom backend doesn't support building appbundle")
 	}
 
-	apk, err := b.BuildApk(androidDir, filepath.Join("target", "android"))
+	b, err := androidbuilder.NewCustomBuilderContext(ctx, androidDir, download,
+		androidbuilder.DownloadOptLogger(logger()),
+	)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	return apk
+	return b.BuildApkContext(ctx, androidDir, filepath.Join("target", "android"),
+		androidbuilder.CustomBuildOptEventHandler(builderEvents),
+		androidbuilder.CustomBuildOptLogger(logger()),
+	)
 }
 
-func gradleBuildAndroid(targetType string) string {
+func gradleBuildAndroid(ctx context.Context, targetType string) (string, error) {
 	b, err := androidbuilder.NewGradleBuilder()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	var opts []androidbuilder.GradleBuildApkOption
+	opts := []androidbuilder.GradleBuildApkOption{
+		androidbuilder.GradleBuilderOptEventHandler(builderEvents),
+		androidbuilder.GradleBuilderOptLogger(logger()),
+	}
 	if release {
 		opts = append(opts, androidbuilder.GradleBuilderOptRelease())
 	}
 
 	switch targetType {
 	case "apk":
-		apk, err := b.BuildApk(androidDir, opts...)
-		if err != nil {
-			panic(err)
-		}
-
-		return apk
+		return b.BuildApkContext(ctx, androidDir, opts...)
 
 	case "appbundle":
-		aab, err := b.BuildAppbundle(androidDir, opts...)
-		if err != nil {
-			panic(err)
-		}
-
-		return aab
+		return b.BuildAppbundleContext(ctx, androidDir, opts...)
 
 	default:
-		panic("invalid target type")
+		return "", usageError("invalid target type %q", targetType)
+	}
+}
+
+func runAndroid(ctx context.Context, apk string) error {
+	adb, err := findAdb()
+	if err != nil {
+		return err
+	}
+
+	pid, err := installAndLaunch(adb, apk, false)
+	if err != nil {
+		return err
 	}
+
+	return logcat(ctx, adb, pid)
 }
 
-func runAndroid(apk string) {
+func findAdb() (string, error) {
 	androidSdkRoot, _, err := androidbuilder.GetAndroidSdkRoot()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	adb := filepath.Join(androidSdkRoot, "platform-tools", "adb")
@@ -229,40 +426,56 @@ func runAndroid(apk string) {
 		adb += ".exe"
 	}
 
+	return adb, nil
+}
+
+// installAndLaunch installs apk and starts its launcher activity, if restart
+// is set the app is force stopped first. Returns pid of the started app.
+func installAndLaunch(adb, apk string, restart bool) (string, error) {
 	{
 		cmd := exec.Command(adb, "install", apk)
 		cmd.Stderr = os.Stderr
 		cmd.Stdout = os.Stdout
-		fmt.Println(cmd.String())
-		err = cmd.Run()
+		err := runCmd("install", cmd)
 		if err != nil {
-			panic(err)
+			return "", deviceError(fmt.Errorf("adb install: %w", err))
 		}
 	}
 
 	pkgName, activityName, err := findPackageAndActivity()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	{
-		cmd := exec.Command(adb, "shell", "am", "start", "-W", "-n", pkgName+"/"+pkgName+activityName)
+		args := []string{"shell", "am", "start", "-W"}
+		if restart {
+			args = append(args, "-S")
+		}
+		// activities are either relative to the package, e.g. ".MainActivity"
+		// which am resolves itself, or fully qualified, e.g.
+		// "android.app.NativeActivity"
+		if !strings.Contains(activityName, ".") {
+			activityName = "." + activityName
+		}
+		args = append(args, "-n", pkgName+"/"+activityName)
+
+		cmd := exec.Command(adb, args...)
 		cmd.Stderr = os.Stderr
 		cmd.Stdout = os.Stdout
-		fmt.Println(cmd.String())
-		err = cmd.Run()
+		err = runCmd("launch", cmd)
 		if err != nil {
-			panic(err)
+			return "", deviceError(fmt.Errorf("adb shell am start: %w", err))
 		}
 	}
 
 	var pid string
 	{
 		cmd := exec.Command(adb, "shell", "pidof", pkgName)
-		fmt.Println(cmd.String())
-		out, err := cmd.CombinedOutput()
+		cmd.Stderr = os.Stderr
+		out, err := outputCmd("launch", cmd)
 		if err != nil {
-			panic(err)
+			return "", deviceError(fmt.Errorf("adb shell pidof: %w", err))
 		}
 
 		pids := strings.Split(strings.TrimSpace(string(out)), " ")
@@ -272,19 +485,23 @@ func runAndroid(apk string) {
 	}
 
 	if pid == "" {
-		panic("failed to get pid")
+		return "", deviceError(errors.New("failed to get pid of " + pkgName))
 	}
 
-	{
-		cmd := exec.Command(adb, "logcat", "--pid", pid)
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
-		fmt.Println(cmd.String())
-		err = cmd.Run()
-		if err != nil {
-			panic(err)
-		}
+	return pid, nil
+}
+
+// logcat streams logs of pid until it exits or ctx is cancelled
+func logcat(ctx context.Context, adb, pid string) error {
+	cmd := exec.CommandContext(ctx, adb, "logcat", "--pid", pid)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	err := runCmd("logcat", cmd)
+	if err != nil && ctx.Err() == nil {
+		return deviceError(fmt.Errorf("adb logcat: %w", err))
 	}
+
+	return nil
 }
 
 func findPackageAndActivity() (pkgName string, activityName string, err error) {
@@ -325,5 +542,5 @@ func findPackageAndActivity() (pkgName string, activityName string, err error) {
 		}
 	}
 
-	return "", "", errors.New("unable to find")
+	return "", "", errors.New("findPackageNameAndActivityName: unable to find launcher activity in " + manifestFile)
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// buildmodes accepted by -buildmode
+var androidBuildModes = []string{"c-shared", "c-archive"}
+
+// goLibsDir holds outputs of -buildmode=c-archive, "<abi>/lib<name>.a" and
+// "<abi>/lib<name>.h", along with snippets importing them into CMake and
+// ndk-build
+func goLibsDir() string {
+	return filepath.Join(androidDir, "app", "src", "main", "golibs")
+}
+
+// writeArchiveSnippets writes golibs.cmake and Android.mk for libs,
+// files are left untouched if their content didn't change, so that
+// gradle doesn't reconfigure the native build needlessly
+func writeArchiveSnippets(libs []goLibrary) error {
+	names := make([]string, len(libs))
+	for i, lib := range libs {
+		names[i] = lib.name
+	}
+
+	t, err := template.ParseFS(templates, "templates/golibs/*.tmpl")
+	if err != nil {
+		return fmt.Errorf("writeArchiveSnippets: %w", err)
+	}
+
+	err = os.MkdirAll(goLibsDir(), 0755)
+	if err != nil {
+		return fmt.Errorf("writeArchiveSnippets: %w", err)
+	}
+
+	for _, name := range []string{"golibs.cmake", "Android.mk"} {
+		var b bytes.Buffer
+		err := t.ExecuteTemplate(&b, name+".tmpl", names)
+		if err != nil {
+			return fmt.Errorf("writeArchiveSnippets: %w", err)
+		}
+
+		file := filepath.Join(goLibsDir(), name)
+		if old, err := os.ReadFile(file); err == nil && bytes.Equal(old, b.Bytes()) {
+			continue
+		}
+
+		err = os.WriteFile(file, b.Bytes(), 0644)
+		if err != nil {
+			return fmt.Errorf("writeArchiveSnippets: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// go file written by "bind java" in the bound package
+const bindGoFile = "tsukuru_bind.go"
+
+// marks go functions bound to a static native method,
+// "//tsukuru:java <class> [method]"
+const javaDirective = "//tsukuru:java"
+
+// bindType is a go type that can cross JNI
+type bindType struct {
+	Go    string
+	Java  string
+	CType string
+}
+
+var bindTypes = []bindType{
+	{"string", "String", "jstring"},
+	{"bool", "boolean", "jboolean"},
+	{"int8", "byte", "jbyte"},
+	{"uint8", "byte", "jbyte"},
+	{"byte", "byte", "jbyte"},
+	{"int16", "short", "jshort"},
+	{"uint16", "char", "jchar"},
+	{"int32", "int", "jint"},
+	{"rune", "int", "jint"},
+	{"uint32", "int", "jint"},
+	{"int", "long", "jlong"},
+	{"uint", "long", "jlong"},
+	{"int64", "long", "jlong"},
+	{"uint64", "long", "jlong"},
+	{"uintptr", "long", "jlong"},
+	{"float32", "float", "jfloat"},
+	{"float64", "double", "jdouble"},
+	{"[]byte", "byte[]", "jbyteArray"},
+}
+
+type bindParam struct {
+	bindType
+	// Name of the parameter in the go wrapper
+	Name string
+	// JavaName of the parameter in the native declaration
+	JavaName string
+}
+
+// ToGo converts the parameter to its go type
+func (p bindParam) ToGo() string {
+	switch p.Go {
+	case "string":
+		return "tsukuruGoString(env, " + p.Name + ")"
+	case "[]byte":
+		return "tsukuruGoBytes(env, " + p.Name + ")"
+	case "bool":
+		return p.Name + " != C.JNI_FALSE"
+	default:
+		return p.Go + "(" + p.Name + ")"
+	}
+}
+
+type bindResult struct {
+	bindType
+}
+
+// ToJava converts the result "r" to its JNI type
+func (r bindResult) ToJava() string {
+	switch r.Go {
+	case "string":
+		return "tsukuruJavaString(env, r)"
+	case "[]byte":
+		return "tsukuruJavaBytes(env, r)"
+	case "bool":
+		return "tsukuruJavaBool(r)"
+	default:
+		return "C." + r.CType + "(r)"
+	}
+}
+
+// boundFunc is a go function marked with javaDirective
+type boundFunc struct {
+	pos    string
+	GoName string
+	// Class is the fully qualified name of the java class
+	Class  string
+	Method string
+	Params []bindParam
+	Result *bindResult
+	// Err is set if the last result of the function is an error
+	Err bool
+}
+
+func (f boundFunc) Symbol() string {
+	return androidbuilder.JNIFunctionName(f.Class, f.Method)
+}
+
+// Exception is the class thrown for errors, in the form of FindClass
+func (f boundFunc) Exception() string {
+	return strings.ReplaceAll(f.Class, ".", "/") + "$GoException"
+}
+
+// bindJava generates java classes declaring native methods for functions
+// of the go package in dir marked with "//tsukuru:java <class> [method]",
+// and the go wrappers implementing them
+func bindJava(dir string) error {
+	pkgName, funcs, err := parseBoundFuncs(dir)
+	if err != nil {
+		return err
+	}
+	if len(funcs) == 0 {
+		return usageError("no functions marked with %s <class> in %s", javaDirective, displayPath(dir))
+	}
+
+	t, err := template.ParseFS(templates, "templates/bind/*.tmpl")
+	if err != nil {
+		return fmt.Errorf("bindJava: %w", err)
+	}
+
+	var b bytes.Buffer
+	err = t.ExecuteTemplate(&b, "bind.go.tmpl", map[string]any{
+		"Package":   pkgName,
+		"Functions": funcs,
+	})
+	if err != nil {
+		return fmt.Errorf("bindJava: %w", err)
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("bindJava: %w", err)
+	}
+	err = writeGenerated(filepath.Join(dir, bindGoFile), src)
+	if err != nil {
+		return err
+	}
+
+	classes := map[string][]boundFunc{}
+	for _, f := range funcs {
+		classes[f.Class] = append(classes[f.Class], f)
+	}
+
+	for class, methods := range classes {
+		pkg, name := "", class
+		if i := strings.LastIndexByte(class, '.'); i >= 0 {
+			pkg, name = class[:i], class[i+1:]
+		}
+
+		var throws bool
+		for _, m := range methods {
+			throws = throws || m.Err
+		}
+
+		b.Reset()
+		err := t.ExecuteTemplate(&b, "Class.java.tmpl", map[string]any{
+			"Package": pkg,
+			"Name":    name,
+			"LibName": libName,
+			"Throws":  throws,
+			"Methods": methods,
+		})
+		if err != nil {
+			return fmt.Errorf("bindJava: %w", err)
+		}
+
+		file := filepath.Join(androidDir, "app", "src", "main", "java", filepath.FromSlash(strings.ReplaceAll(class, ".", "/"))+".java")
+		err = writeGenerated(file, b.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func bindError(err error) error {
+	return &cliError{
+		kind: kindCompile,
+		hint: "bound functions take and return string, bool, []byte, ints and floats, optionally followed by an error result, and are marked with " + javaDirective + " <class> [method]",
+		err:  err,
+	}
+}
+
+// writeGenerated writes content to name, unless it's already there,
+// to not touch the fingerprints of builds needlessly
+func writeGenerated(name string, content []byte) error {
+	if old, err := os.ReadFile(name); err == nil && bytes.Equal(old, content) {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return fmt.Errorf("writeGenerated: %w", err)
+	}
+	err = os.WriteFile(name, content, 0644)
+	if err != nil {
+		return fmt.Errorf("writeGenerated: %w", err)
+	}
+
+	fmt.Println("Generated", displayPath(name))
+	return nil
+}
+
+// parseBoundFuncs returns the name of the go package in dir and its
+// functions marked with javaDirective, sorted by class and method
+func parseBoundFuncs(dir string) (string, []boundFunc, error) {
+	ctx := build.Default
+	ctx.GOOS = "android"
+	ctx.GOARCH = "arm64"
+	ctx.CgoEnabled = true
+	ctx.BuildTags = strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' })
+
+	pkg, err := ctx.ImportDir(dir, 0)
+	if err != nil {
+		return "", nil, usageError("%w", err)
+	}
+
+	var (
+		fset  = token.NewFileSet()
+		funcs []boundFunc
+		// positions of bound methods, for reporting duplicates
+		seen = map[string]string{}
+	)
+
+	for _, name := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		if name == bindGoFile {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return "", nil, compileError(fmt.Errorf("parseBoundFuncs: %w", err))
+		}
+
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Doc == nil {
+				continue
+			}
+
+			for _, c := range fn.Doc.List {
+				fields := strings.Fields(c.Text)
+				if len(fields) == 0 || fields[0] != javaDirective {
+					continue
+				}
+
+				pos := displayPath(fset.Position(c.Pos()).String())
+				bound, err := boundFunction(fn, fields[1:])
+				if err != nil {
+					return "", nil, bindError(fmt.Errorf("%s: %s: %w", pos, fn.Name.Name, err))
+				}
+				bound.pos = pos
+
+				key := bound.Class + "." + bound.Method
+				if prev, ok := seen[key]; ok {
+					return "", nil, bindError(fmt.Errorf("%s: %s is already bound at %s", pos, key, prev))
+				}
+				seen[key] = pos
+
+				funcs = append(funcs, bound)
+			}
+		}
+	}
+
+	sort.Slice(funcs, func(i, j int) bool {
+		if funcs[i].Class != funcs[j].Class {
+			return funcs[i].Class < funcs[j].Class
+		}
+		return funcs[i].Method < funcs[j].Method
+	})
+
+	return pkg.Name, funcs, nil
+}
+
+// boundFunction checks that the signature of fn can cross JNI, args are
+// the fields of the directive after it
+func boundFunction(fn *ast.FuncDecl, args []string) (boundFunc, error) {
+	if fn.Recv != nil {
+		return boundFunc{}, fmt.Errorf("methods can't be bound, only functions")
+	}
+	if fn.Type.TypeParams != nil {
+		return boundFunc{}, fmt.Errorf("generic functions can't be bound")
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return boundFunc{}, fmt.Errorf("expected %s <class> [method]", javaDirective)
+	}
+
+	f := boundFunc{
+		GoName: fn.Name.Name,
+		Class:  args[0],
+		Method: lowerFirst(fn.Name.Name),
+	}
+	if len(args) == 2 {
+		f.Method = args[1]
+	}
+
+	for _, part := range strings.Split(f.Class, ".") {
+		if !isJavaName(part) {
+			return boundFunc{}, fmt.Errorf("invalid java class name %q", f.Class)
+		}
+	}
+	if !isJavaName(f.Method) {
+		return boundFunc{}, fmt.Errorf("invalid java method name %q, set one with %s %s <method>", f.Method, javaDirective, f.Class)
+	}
+
+	var i int
+	for _, field := range fn.Type.Params.List {
+		t, err := bindTypeOf(field.Type)
+		if err != nil {
+			return boundFunc{}, err
+		}
+
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{nil}
+		}
+		for _, n := range names {
+			javaName := "p" + strconv.Itoa(i)
+			if n != nil && n.Name != "_" && isJavaName(n.Name) {
+				javaName = n.Name
+			}
+			f.Params = append(f.Params, bindParam{bindType: t, Name: "p" + strconv.Itoa(i), JavaName: javaName})
+			i++
+		}
+	}
+
+	var results []ast.Expr
+	if fn.Type.Results != nil {
+		for _, field := range fn.Type.Results.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				results = append(results, field.Type)
+			}
+		}
+	}
+
+	if len(results) > 0 {
+		if id, ok := results[len(results)-1].(*ast.Ident); ok && id.Name == "error" {
+			f.Err = true
+			results = results[:len(results)-1]
+		}
+	}
+	switch len(results) {
+	case 0:
+	case 1:
+		t, err := bindTypeOf(results[0])
+		if err != nil {
+			return boundFunc{}, err
+		}
+		f.Result = &bindResult{t}
+	default:
+		return boundFunc{}, fmt.Errorf("expected at most one result and an error")
+	}
+
+	return f, nil
+}
+
+func bindTypeOf(expr ast.Expr) (bindType, error) {
+	var name string
+	switch e := expr.(type) {
+	case *ast.Ident:
+		name = e.Name
+	case *ast.ArrayType:
+		if id, ok := e.Elt.(*ast.Ident); ok && e.Len == nil && (id.Name == "byte" || id.Name == "uint8") {
+			name = "[]byte"
+		}
+	case *ast.Ellipsis:
+		return bindType{}, fmt.Errorf("variadic parameters are not supported")
+	}
+
+	for _, t := range bindTypes {
+		if t.Go == name {
+			return t, nil
+		}
+	}
+
+	var b bytes.Buffer
+	_ = format.Node(&b, token.NewFileSet(), expr)
+	return bindType{}, fmt.Errorf("unsupported type %s, expected string, bool, []byte, error or a sized or unsized int, uint or float", b.String())
+}
+
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+var javaKeywords = []string{
+	"abstract", "assert", "boolean", "break", "byte", "case", "catch", "char", "class", "const",
+	"continue", "default", "do", "double", "else", "enum", "extends", "final", "finally", "float",
+	"for", "goto", "if", "implements", "import", "instanceof", "int", "interface", "long", "native",
+	"new", "package", "private", "protected", "public", "return", "short", "static", "strictfp", "super",
+	"switch", "synchronized", "this", "throw", "throws", "transient", "try", "void", "volatile", "while",
+	"true", "false", "null", "var", "record", "yield",
+}
+
+// isJavaName reports whether s is usable as a java identifier
+func isJavaName(s string) bool {
+	if s == "" || contains(javaKeywords, s) {
+		return false
+	}
+	return isJavaIdent(javaToken{text: s}) && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$'
+	}) < 0
+}
@@ -13,21 +13,31 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-func checkin(mainPackagePath string) {
+func checkin(mainPackagePath string) (err error) {
+	done := startStep("checkin")
+	defer func() { done(err) }()
+
 	// CGO_ENABLED=1 GOOS=android go list -deps -f '{{ .Dir }}'
 
-	cmd := exec.Command("go", "list", "-deps", "-f", "{{ .Dir }}", mainPackagePath)
+	libs, err := androidLibraries(mainPackagePath)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"list", "-deps", "-f", "{{ .Dir }}"}
+	args = append(args, libPackages(libs)...)
+
+	cmd := exec.Command("go", args...)
 	cmd.Env = append(os.Environ(),
 		"CGO_ENABLED=1",
 		"GOOS=android",
 	)
-	fmt.Println(cmd.String())
-	out, err := cmd.Output()
+	out, err := outputCmd("checkin", cmd)
 	if err != nil {
 		if ee, ok := err.(*exec.ExitError); ok {
 			os.Stderr.Write(ee.Stderr)
 		}
-		panic(err)
+		return compileError(fmt.Errorf("checkin: %w", err))
 	}
 
 	dependenciesFromTsukuruFile := []string{}
@@ -37,7 +47,7 @@ func checkin(mainPackagePath string) {
 		dir := strings.TrimSpace(s.Text())
 		entries, err := os.ReadDir(dir + "/")
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("checkin: %w", err)
 		}
 		for _, entry := range entries {
 			name := entry.Name()
@@ -45,7 +55,7 @@ func checkin(mainPackagePath string) {
 				path := filepath.Join(dir, name)
 				tf, err := readTsukuruFile(path)
 				if err != nil {
-					panic("failed to parse tsukurufile at: " + path)
+					return err
 				}
 
 				dependenciesFromTsukuruFile = append(dependenciesFromTsukuruFile, tf.Android.Dependencies...)
@@ -56,12 +66,12 @@ func checkin(mainPackagePath string) {
 	// TODO: handle versioning
 	dependenciesFromTsukuruFile, err = deduplicate(dependenciesFromTsukuruFile)
 	if err != nil {
-		panic(err)
+		return &cliError{kind: kindTsukurufile, hint: "use the same version of the dependency in every tsukurufile", err: err}
 	}
 
 	dependenciesFromBuildGradle, err := getDependenciesFromBuildGradle()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	for i, dep := range dependenciesFromTsukuruFile {
@@ -70,10 +80,7 @@ func checkin(mainPackagePath string) {
 		}
 	}
 
-	err = writeDependenciesToBuildGradle(dependenciesFromTsukuruFile)
-	if err != nil {
-		panic(err)
-	}
+	return writeDependenciesToBuildGradle(dependenciesFromTsukuruFile)
 }
 
 type TsukuruFile struct {
@@ -99,14 +106,18 @@ func readTsukuruFile(name string) (tsukuruFile TsukuruFile, err error) {
 	defer f.Close()
 
 	isAndroidBlock := false
+	blockStart := 0
+	lineNum := 0
 	s := bufio.NewScanner(f)
 	for s.Scan() {
+		lineNum++
 		l := strings.TrimSpace(s.Text())
 
 		if !isAndroidBlock &&
 			(strings.HasPrefix(l, "android (") ||
 				strings.HasPrefix(l, "android(")) {
 			isAndroidBlock = true
+			blockStart = lineNum
 			continue
 		}
 
@@ -115,18 +126,31 @@ func readTsukuruFile(name string) (tsukuruFile TsukuruFile, err error) {
 		}
 
 		if isAndroidBlock {
+			if l == "" || strings.HasPrefix(l, "//") {
+				continue
+			}
+
 			l = strings.TrimPrefix(l, "'")
 			l = strings.TrimPrefix(l, "\"")
 
 			i := strings.IndexFunc(l, func(r rune) bool {
 				return r == '\'' || r == '"'
 			})
-			if i != -1 {
-				l = l[:i]
-				tsukuruFile.Android.Dependencies = append(tsukuruFile.Android.Dependencies, l)
+			if i == -1 {
+				return tsukuruFile, &tsukurufileError{path: name, line: lineNum, msg: "expected a quoted dependency, got: " + l}
 			}
+
+			l = l[:i]
+			tsukuruFile.Android.Dependencies = append(tsukuruFile.Android.Dependencies, l)
 		}
 	}
+	if err := s.Err(); err != nil {
+		return tsukuruFile, fmt.Errorf("readTsukuruFile: %w", err)
+	}
+
+	if isAndroidBlock {
+		return tsukuruFile, &tsukurufileError{path: name, line: blockStart, msg: "unterminated android block, missing \")\""}
+	}
 
 	return
 }
@@ -260,6 +284,13 @@ func writeDependenciesToBuildGradle(dependencies []string) error {
 		}
 	}
 
+	// don't touch build.gradle if nothing changed, so that its
+	// modification time stays stable for watchers and fingerprints
+	old, err := os.ReadFile(buildGradle)
+	if err == nil && bytes.Equal(old, dst.Bytes()) {
+		return nil
+	}
+
 	err = os.WriteFile(buildGradle, dst.Bytes(), 0666)
 	if err != nil {
 		return fmt.Errorf("writeDependenciesToBuildGradle: %w", err)
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// # build settings in tsukurufile
+//
+//	tsukuru v1alpha
+//
+//	build (
+//	    androidbackend = "custom"
+//	    goarches = "arm64,amd64"
+//	)
+//
+//	build apk (
+//	    libname = "game"
+//	    libs = "./plugins=plugins"
+//	)
+//
+//	profile dev (
+//	    tags = "debug"
+//	)
+//
+//	abi arm64 (
+//	    tags = "neon"
+//	    cgo_ldflags = "-L/path/to/prebuilt/arm64-v8a"
+//	)
+//
+// keys are names of the flags of build and run commands, settings are
+// merged in order: "build", "build <target>", "profile <name>" and then
+// command line flags.
+// keys of "abi <goarch>" blocks are the ones accepted by -abi, settings from
+// -abi are applied after them.
+
+// buildConfig holds the build settings read from the tsukurufile
+// next to the main package
+type buildConfig struct {
+	path string
+
+	defaults map[string]string
+	targets  map[string]map[string]string
+	profiles map[string]map[string]string
+
+	// in the form accepted by -abi
+	abis []string
+}
+
+var configTargets = []string{"apk", "appbundle", "wasm"}
+
+// keys that hold paths, relative values are resolved against the
+// directory of the tsukurufile
+var configPathKeys = []string{"androiddir"}
+
+// keys that hold <package>=<libname> pairs, relative packages are
+// resolved against the directory of the tsukurufile
+var configLibsKeys = []string{"libs"}
+
+func readBuildConfig(name string) (*buildConfig, error) {
+	c := &buildConfig{
+		path:     name,
+		defaults: map[string]string{},
+		targets:  map[string]map[string]string{},
+		profiles: map[string]map[string]string{},
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("readBuildConfig: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		block map[string]string
+		// GOARCH of the abi block being read
+		abiBlock string
+	)
+	blockStart := 0
+	lineNum := 0
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lineNum++
+		l := strings.TrimSpace(s.Text())
+
+		if block == nil && abiBlock == "" {
+			if !strings.HasSuffix(l, "(") {
+				continue
+			}
+
+			fields := strings.Fields(strings.TrimSuffix(l, "("))
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch {
+			case fields[0] == "build" && len(fields) == 1:
+				block = c.defaults
+
+			case fields[0] == "build" && len(fields) == 2:
+				if !contains(configTargets, fields[1]) {
+					return nil, &tsukurufileError{path: name, line: lineNum, msg: "unknown build target " + fields[1] + ", expected one of " + strings.Join(configTargets, ", ")}
+				}
+				block = map[string]string{}
+				c.targets[fields[1]] = block
+
+			case fields[0] == "profile" && len(fields) == 2:
+				block = map[string]string{}
+				c.profiles[fields[1]] = block
+
+			case fields[0] == "abi" && len(fields) == 2:
+				abiBlock = fields[1]
+
+			case fields[0] == "build" || fields[0] == "profile" || fields[0] == "abi":
+				return nil, &tsukurufileError{path: name, line: lineNum, msg: "malformed " + fields[0] + " block"}
+
+			default:
+				// not a build settings block
+				continue
+			}
+
+			blockStart = lineNum
+			continue
+		}
+
+		if strings.HasPrefix(l, ")") {
+			block = nil
+			abiBlock = ""
+			continue
+		}
+
+		if l == "" || strings.HasPrefix(l, "//") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(l, "=")
+		if !ok {
+			return nil, &tsukurufileError{path: name, line: lineNum, msg: "expected key = value, got: " + l}
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		if abiBlock != "" {
+			setting := abiBlock + "." + key + "=" + value
+			_, _, _, err := parseABISetting(setting)
+			if err != nil {
+				return nil, &tsukurufileError{path: name, line: lineNum, msg: err.Error()}
+			}
+			c.abis = append(c.abis, setting)
+			continue
+		}
+
+		if !isBuildFlag(key) || key == "profile" {
+			return nil, &tsukurufileError{path: name, line: lineNum, msg: "unknown setting " + key}
+		}
+
+		if contains(configPathKeys, key) && value != "" && !filepath.IsAbs(value) {
+			value = filepath.Join(filepath.Dir(name), value)
+		}
+
+		if contains(configLibsKeys, key) {
+			value = resolveLibPackages(value, filepath.Dir(name))
+		}
+
+		block[key] = value
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("readBuildConfig: %w", err)
+	}
+
+	if block != nil || abiBlock != "" {
+		return nil, &tsukurufileError{path: name, line: blockStart, msg: "unterminated block, missing \")\""}
+	}
+
+	return c, nil
+}
+
+// resolveLibPackages resolves relative packages of <package>=<libname>
+// pairs against dir
+func resolveLibPackages(value, dir string) string {
+	pairs := strings.Split(value, ",")
+	for i, pair := range pairs {
+		pkg, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && build.IsLocalImport(pkg) {
+			pairs[i] = filepath.Join(dir, pkg) + "=" + name
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// settings merges defaults, target and profile settings
+func (c *buildConfig) settings(target, profile string) (map[string]string, error) {
+	out := map[string]string{}
+
+	for k, v := range c.defaults {
+		out[k] = v
+	}
+	for k, v := range c.targets[target] {
+		out[k] = v
+	}
+
+	if profile != "" {
+		p, ok := c.profiles[profile]
+		if !ok {
+			return nil, usageError("profile %q not found in %s", profile, c.path)
+		}
+		for k, v := range p {
+			out[k] = v
+		}
+	}
+
+	return out, nil
+}
+
+// applyBuildConfig sets flags that were not passed on the command line
+// from the settings, settings not supported by the flag set are ignored
+func applyBuildConfig(fset *flag.FlagSet, settings map[string]string, path string) error {
+	passed := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) {
+		passed[f.Name] = true
+	})
+
+	for key, value := range settings {
+		if passed[key] || fset.Lookup(key) == nil {
+			continue
+		}
+
+		err := fset.Set(key, value)
+		if err != nil {
+			return &tsukurufileError{path: path, msg: "invalid value for " + key + ": " + err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// isBuildFlag reports whether name is a flag of the commands building
+// a target, the ones settings of tsukurufile are applied to
+func isBuildFlag(name string) bool {
+	for _, c := range []*flag.FlagSet{buildApkCmd, buildAppbundleCmd, runApkCmd, buildWasmCmd, runWasmCmd} {
+		if c.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTsukurufile(t *testing.T, content string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "tsukurufile")
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReadBuildConfig(t *testing.T) {
+	name := writeTsukurufile(t, `tsukuru v1alpha
+
+// blocks that are not build settings are skipped
+android (
+    appid = "com.example.app"
+)
+
+build (
+    androidbackend = "custom"
+    goarches = 'arm64,amd64'
+
+    // comments and blank lines are skipped
+    ldflags = "-X main.version=1.0"
+    androiddir = "mobile/android"
+)
+
+build apk (
+    libname = game
+    libs = "./plugins=plugins, example.com/audio=audio"
+)
+
+build wasm (
+    tags = "wasm"
+)
+
+profile dev (
+    tags = "debug"
+    androiddir = "/abs/android"
+)
+
+abi arm64 (
+    tags = "neon"
+    cgo_ldflags = "-L/prebuilt/arm64-v8a"
+)
+`)
+	dir := filepath.Dir(name)
+
+	c, err := readBuildConfig(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &buildConfig{
+		path: name,
+		defaults: map[string]string{
+			"androidbackend": "custom",
+			"goarches":       "arm64,amd64",
+			"ldflags":        "-X main.version=1.0",
+			"androiddir":     filepath.Join(dir, "mobile", "android"),
+		},
+		targets: map[string]map[string]string{
+			"apk": {
+				"libname": "game",
+				"libs":    filepath.Join(dir, "plugins") + "=plugins, example.com/audio=audio",
+			},
+			"wasm": {"tags": "wasm"},
+		},
+		profiles: map[string]map[string]string{
+			"dev": {"tags": "debug", "androiddir": "/abs/android"},
+		},
+		abis: []string{"arm64.tags=neon", "arm64.cgo_ldflags=-L/prebuilt/arm64-v8a"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("readBuildConfig =\n%#v\nwant\n%#v", c, want)
+	}
+
+	settings, err := c.settings("apk", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings["tags"] != "debug" || settings["libname"] != "game" || settings["androiddir"] != "/abs/android" || settings["goarches"] != "arm64,amd64" {
+		t.Errorf("settings of apk with profile dev = %v", settings)
+	}
+
+	if _, err := c.settings("apk", "missing"); err == nil {
+		t.Error("settings with a missing profile succeeded")
+	}
+}
+
+func TestReadBuildConfigMissing(t *testing.T) {
+	c, err := readBuildConfig(filepath.Join(t.TempDir(), "tsukurufile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.defaults) != 0 || len(c.targets) != 0 || len(c.profiles) != 0 || len(c.abis) != 0 {
+		t.Errorf("readBuildConfig of a missing file = %#v, want an empty config", c)
+	}
+}
+
+func TestReadBuildConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+		msg     string
+	}{
+		{"unknown target", "build ios (\n)\n", 1, "unknown build target ios"},
+		{"malformed build", "build apk debug (\n)\n", 1, "malformed build block"},
+		{"malformed profile", "profile (\n)\n", 1, "malformed profile block"},
+		{"missing value", "build (\n    goarches\n)\n", 2, "expected key = value"},
+		{"nested block", "build (\n    build apk (\n    )\n)\n", 2, "expected key = value"},
+		{"unknown key", "build (\n    nosuchflag = 1\n)\n", 2, "unknown setting nosuchflag"},
+		{"init flag", "build (\n    appid = \"com.example.app\"\n)\n", 2, "unknown setting appid"},
+		{"init flag in profile", "profile dev (\n    nativeactivity = true\n)\n", 2, "unknown setting nativeactivity"},
+		{"test flag", "build apk (\n    adb = \"/bin/adb\"\n)\n", 2, "unknown setting adb"},
+		{"profile key", "build (\n    profile = \"dev\"\n)\n", 2, "unknown setting profile"},
+		{"unknown abi key", "abi arm64 (\n    nosuchkey = 1\n)\n", 2, "unknown abi setting"},
+		{"unterminated", "build (\n    goarches = \"arm64\"\n", 1, "unterminated block"},
+		{"unterminated abi", "build (\n)\nabi arm64 (\n    tags = \"neon\"\n", 3, "unterminated block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readBuildConfig(writeTsukurufile(t, tt.content))
+
+			var terr *tsukurufileError
+			if !errors.As(err, &terr) {
+				t.Fatalf("readBuildConfig returned %v, want a tsukurufile error", err)
+			}
+			if terr.line != tt.line || !strings.Contains(terr.msg, tt.msg) {
+				t.Errorf("readBuildConfig returned %v, want line %d with %q", err, tt.line, tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+type checkStatus string
+
+const (
+	statusPass checkStatus = "pass"
+	statusWarn checkStatus = "warn"
+	statusFail checkStatus = "fail"
+)
+
+type checkResult struct {
+	Name   string      `json:"name"`
+	Status checkStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Fix    string      `json:"fix,omitempty"`
+}
+
+// minimum go version required for building, same as in go.mod
+const minGoMinor = 18
+
+// GOOS/GOARCH pairs that tsukuru builds for
+var requiredPlatforms = []string{"android/arm64", "android/arm", "android/amd64", "android/386", "js/wasm"}
+
+// doctor checks the environment upfront, instead of failing later in the build
+func doctor(mainPackagePath string) error {
+	if androidDir == "" && mainPackagePath != "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		pkg, err := build.Import(mainPackagePath, wd, build.FindOnly)
+		if err != nil {
+			return usageError("%w", err)
+		}
+
+		androidDir = filepath.Join(pkg.Dir, "android")
+	}
+
+	var results []checkResult
+	results = append(results, checkGoVersion())
+	results = append(results, checkGoPlatforms())
+	results = append(results, checkWasmExec())
+	results = append(results, checkAndroid()...)
+	results = append(results, checkJava())
+	if androidDir != "" {
+		results = append(results, checkGradlew())
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == statusFail {
+			failed++
+		}
+	}
+
+	if jsonOutput {
+		for i := range results {
+			emit(event{Kind: "check", Check: &results[i]})
+		}
+	} else {
+		printChecks(results)
+	}
+
+	if failed > 0 {
+		return environmentError(fmt.Errorf("doctor: %d of %d checks failed", failed, len(results)), "")
+	}
+	return nil
+}
+
+func printChecks(results []checkResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Status, r.Detail)
+	}
+	w.Flush()
+
+	fixes := false
+	for _, r := range results {
+		if r.Status == statusPass || r.Fix == "" {
+			continue
+		}
+		if !fixes {
+			fmt.Println()
+			fmt.Println("To fix:")
+			fixes = true
+		}
+		fmt.Printf("  %s: %s\n", r.Name, r.Fix)
+	}
+}
+
+func checkGoVersion() checkResult {
+	r := checkResult{Name: "go version"}
+
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		r.Status = statusFail
+		r.Detail = err.Error()
+		r.Fix = "install go from https://go.dev/dl and make sure it is in PATH"
+		return r
+	}
+
+	version := strings.TrimSpace(string(out))
+	r.Detail = version
+
+	// "go1.19.3", "go1.21rc2", "devel go1.22-..."
+	v := version[strings.Index(version, "go")+2:]
+	parts := strings.SplitN(v, ".", 3)
+	major, _ := strconv.Atoi(parts[0])
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(strings.TrimFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	}
+
+	if major < 1 || (major == 1 && minor < minGoMinor) {
+		r.Status = statusFail
+		r.Fix = fmt.Sprintf("upgrade go to go1.%d or newer", minGoMinor)
+		return r
+	}
+
+	r.Status = statusPass
+	return r
+}
+
+func checkGoPlatforms() checkResult {
+	r := checkResult{Name: "go platforms"}
+
+	out, err := exec.Command("go", "tool", "dist", "list").Output()
+	if err != nil {
+		r.Status = statusFail
+		r.Detail = err.Error()
+		r.Fix = "make sure the go toolchain in PATH is complete"
+		return r
+	}
+
+	platforms := strings.Fields(string(out))
+	var missing []string
+	for _, p := range requiredPlatforms {
+		if !contains(platforms, p) {
+			missing = append(missing, p)
+		}
+	}
+
+	if len(missing) > 0 {
+		r.Status = statusFail
+		r.Detail = "missing " + strings.Join(missing, ", ")
+		r.Fix = "use an official go distribution, it supports all of " + strings.Join(requiredPlatforms, ", ")
+		return r
+	}
+
+	r.Status = statusPass
+	r.Detail = strings.Join(requiredPlatforms, ", ")
+	return r
+}
+
+func checkWasmExec() checkResult {
+	r := checkResult{Name: "wasm_exec.js"}
+
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		r.Status = statusFail
+		r.Detail = err.Error()
+		r.Fix = "make sure the go toolchain is in PATH"
+		return r
+	}
+
+	file, err := findWasmSupportFile(strings.TrimSpace(string(out)), "wasm_exec.js")
+	if err != nil {
+		r.Status = statusWarn
+		r.Detail = err.Error()
+		r.Fix = "reinstall go, \"tsukuru run wasm\" needs wasm_exec.js from GOROOT"
+		return r
+	}
+
+	r.Status = statusPass
+	r.Detail = file
+	return r
+}
+
+func checkAndroid() []checkResult {
+	sdk := checkResult{Name: "android sdk"}
+	licenses := checkResult{Name: "android sdk licenses"}
+	ndk := checkResult{Name: "android ndk"}
+
+	androidSdkRoot, accepted, err := androidbuilder.GetAndroidSdkRoot()
+	if err != nil {
+		_, hint := classify(err)
+
+		sdk.Status = statusFail
+		sdk.Detail = err.Error()
+		sdk.Fix = hint
+
+		for _, r := range []*checkResult{&licenses, &ndk} {
+			r.Status = statusWarn
+			r.Detail = "skipped, android sdk not found"
+		}
+
+		return []checkResult{sdk, licenses, ndk}
+	}
+
+	sdk.Status = statusPass
+	sdk.Detail = androidSdkRoot
+
+	sdkmanager := filepath.Join(androidSdkRoot, "cmdline-tools", "latest", "bin", "sdkmanager")
+	if accepted {
+		licenses.Status = statusPass
+	} else {
+		licenses.Status = statusFail
+		licenses.Fix = "run \"" + sdkmanager + " --licenses\""
+	}
+
+	// same resolution as builds, without downloading
+	var opts []androidbuilder.ResolveNdkOption
+	if ndkVersion != "" {
+		opts = append(opts, androidbuilder.ResolveNdkOptVersion(ndkVersion))
+	}
+	ndkDir, err := androidbuilder.ResolveNdk(context.Background(), androidSdkRoot, androidDir, opts...)
+	if err != nil {
+		ndk.Status = statusWarn
+		ndk.Detail = err.Error() + ", builds with -download=true will install it"
+		ndk.Fix = "run \"" + sdkmanager + " 'ndk;<version>'\""
+	} else {
+		ndk.Status = statusPass
+		ndk.Detail = ndkDir
+	}
+
+	return []checkResult{sdk, licenses, ndk}
+}
+
+func checkJava() checkResult {
+	r := checkResult{Name: "jdk"}
+
+	javaHome, err := androidbuilder.FindJavaHome()
+	if err != nil {
+		_, hint := classify(err)
+
+		r.Status = statusFail
+		r.Detail = err.Error()
+		r.Fix = hint
+		return r
+	}
+
+	r.Status = statusPass
+	r.Detail = javaHome
+	return r
+}
+
+func checkGradlew() checkResult {
+	r := checkResult{Name: "gradlew"}
+
+	gradlew := filepath.Join(androidDir, "gradlew")
+	if runtime.GOOS == "windows" {
+		gradlew += ".bat"
+	}
+
+	_, err := os.Stat(gradlew)
+	if err != nil {
+		r.Status = statusWarn
+		r.Detail = err.Error()
+		if errors.Is(err, os.ErrNotExist) {
+			r.Detail = "not found in " + androidDir
+		}
+		r.Fix = "run \"gradle wrapper\" in " + androidDir + ", or build with -androidbackend=custom"
+		return r
+	}
+
+	r.Status = statusPass
+	r.Detail = gradlew
+	return r
+}
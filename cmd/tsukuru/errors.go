@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+type errorKind int
+
+const (
+	kindUnknown errorKind = iota
+	kindUsage
+	kindEnvironment
+	kindCompile
+	kindGradle
+	kindTsukurufile
+	kindDevice
+	kindInterrupted
+)
+
+// exit codes returned by tsukuru, 1 is used for errors
+// that don't fall in any known category
+func (k errorKind) exitCode() int {
+	switch k {
+	case kindUsage:
+		return 2
+	case kindEnvironment:
+		return 3
+	case kindCompile:
+		return 4
+	case kindGradle:
+		return 5
+	case kindTsukurufile:
+		return 6
+	case kindDevice:
+		return 7
+	case kindInterrupted:
+		// same as shells report for SIGINT
+		return 130
+	default:
+		return 1
+	}
+}
+
+func (k errorKind) String() string {
+	switch k {
+	case kindUsage:
+		return "usage"
+	case kindEnvironment:
+		return "environment"
+	case kindCompile:
+		return "compile"
+	case kindGradle:
+		return "gradle"
+	case kindTsukurufile:
+		return "tsukurufile"
+	case kindDevice:
+		return "device"
+	case kindInterrupted:
+		return "interrupted"
+	default:
+		return "unknown"
+	}
+}
+
+// cliError attaches a kind and an actionable hint to an error
+type cliError struct {
+	kind errorKind
+	hint string
+	err  error
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+func (e *cliError) Unwrap() error { return e.err }
+
+func usageError(format string, a ...any) error {
+	return &cliError{kind: kindUsage, err: fmt.Errorf(format, a...)}
+}
+
+func compileError(err error) error {
+	return &cliError{
+		kind: kindCompile,
+		hint: "fix the compile errors reported above, rerun with -x to see the exact toolchain invocations",
+		err:  err,
+	}
+}
+
+func deviceError(err error) error {
+	return &cliError{
+		kind: kindDevice,
+		hint: "check that a device is connected and authorized by running \"adb devices\"",
+		err:  err,
+	}
+}
+
+func environmentError(err error, hint string) error {
+	return &cliError{kind: kindEnvironment, hint: hint, err: err}
+}
+
+type tsukurufileError struct {
+	path string
+	line int
+	msg  string
+}
+
+func (e *tsukurufileError) Error() string {
+	if e.line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.path, e.line, e.msg)
+	}
+	return e.path + ": " + e.msg
+}
+
+// classify finds the kind and the hint for err
+func classify(err error) (errorKind, string) {
+	if errors.Is(err, context.Canceled) {
+		return kindInterrupted, ""
+	}
+
+	var ce *cliError
+	if errors.As(err, &ce) && ce.kind != kindUnknown {
+		return ce.kind, ce.hint
+	}
+
+	var tfe *tsukurufileError
+	if errors.As(err, &tfe) {
+		return kindTsukurufile, "see the \"tsukurufile\" section of the README for the expected format"
+	}
+
+	var ge *androidbuilder.GradleError
+	if errors.As(err, &ge) {
+		return kindGradle, "run \"" + filepath.Join(ge.AndroidDir, "gradlew") + " " + ge.Task + " --stacktrace\" in " + ge.AndroidDir + " for more details"
+	}
+
+	switch {
+	case errors.Is(err, androidbuilder.ErrAndroidSdkNotFound):
+		return kindEnvironment, "install the android sdk command-line tools and platform-tools, then set ANDROID_SDK_ROOT to the sdk directory"
+	case errors.Is(err, androidbuilder.ErrLicensesNotAccepted):
+		return kindEnvironment, "accept the licenses by running \"sdkmanager --licenses\""
+	case errors.Is(err, androidbuilder.ErrNdkNotFound):
+		return kindEnvironment, "install the ndk by running \"sdkmanager 'ndk;<version>'\" or rerun with -download"
+	case errors.Is(err, androidbuilder.ErrNdkToolchainNotFound):
+		return kindEnvironment, "the ndk doesn't ship a toolchain for this host, reinstall it via sdkmanager or build on a linux, darwin or windows host"
+	case errors.Is(err, androidbuilder.ErrSegmentNotAligned):
+		return kindCompile, "link with -extldflags=-Wl,-z,max-page-size=16384, if -ldflags or abi ldflags set -extldflags add it there"
+	case errors.Is(err, androidbuilder.ErrLibraryNotFound):
+		return kindCompile, "copy the library to app/src/main/jniLibs/<abi>, raise minSdkVersion, or rerun with -libwarnings if gradle packages it from a dependency"
+	case errors.Is(err, androidbuilder.ErrNoEntryPoint):
+		return kindCompile, "export a Java_<package>_<class>_<method> function or JNI_OnLoad with //export, and check its name against the native method declaration"
+	case errors.Is(err, androidbuilder.ErrTextRelocations):
+		return kindCompile, "compile c code and static libraries linked into the library with -fPIC"
+	case errors.Is(err, androidbuilder.ErrJavaHomeNotFound):
+		return kindEnvironment, "install a jdk and set JAVA_HOME to its directory"
+	case errors.Is(err, androidbuilder.ErrBuildToolsNotFound):
+		return kindEnvironment, "install the build-tools for your targetSdkVersion via sdkmanager or rerun with -download"
+	case errors.Is(err, androidbuilder.ErrPlatformNotFound):
+		return kindEnvironment, "install the platform for your targetSdkVersion via sdkmanager or rerun with -download"
+	case errors.Is(err, androidbuilder.ErrGradlewNotFound):
+		return kindEnvironment, "generate the gradle wrapper in the android directory, or use -androidbackend=custom"
+	}
+
+	if ce != nil {
+		return ce.kind, ce.hint
+	}
+	return kindUnknown, ""
+}
+
+// exit prints err with a hint and exits with the exit code for its kind
+func exit(err error) {
+	kind := printError(err)
+	os.Exit(kind.exitCode())
+}
+
+// printError reports err without exiting, and returns its kind
+func printError(err error) errorKind {
+	kind, hint := classify(err)
+	emitError(err, kind, hint)
+
+	if kind == kindInterrupted {
+		fmt.Fprintln(os.Stderr, "tsukuru: interrupted")
+		return kind
+	}
+
+	fmt.Fprintln(os.Stderr, "tsukuru:", err)
+	if hint != "" {
+		fmt.Fprintln(os.Stderr, "hint:", hint)
+	}
+	if kind == kindUsage {
+		fmt.Fprintln(os.Stderr)
+		flag.Usage()
+	}
+
+	return kind
+}
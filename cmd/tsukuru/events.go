@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// with -json, newline delimited events are written to stdout,
+// and everything that would normally go to stdout goes to stderr
+var (
+	jsonOutput bool
+
+	eventsMu  sync.Mutex
+	eventsOut io.Writer
+)
+
+type event struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+
+	Step     string   `json:"step,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	Duration float64  `json:"duration,omitempty"` // in seconds
+	Message  string   `json:"message,omitempty"`
+	Error    string   `json:"error,omitempty"`
+
+	// set for "error" events
+	ErrorKind string `json:"errorKind,omitempty"`
+	Hint      string `json:"hint,omitempty"`
+	ExitCode  int    `json:"exitCode,omitempty"`
+
+	Artifact *artifact `json:"artifact,omitempty"`
+
+	// set for "check" events of doctor
+	Check *checkResult `json:"check,omitempty"`
+}
+
+type artifact struct {
+	Path      string   `json:"path"`
+	Target    string   `json:"target"`
+	BuildType string   `json:"buildType"`
+	Size      int64    `json:"size"`
+	Sha256    string   `json:"sha256"`
+	ABIs      []string `json:"abis,omitempty"`
+}
+
+func setupJSONOutput() {
+	eventsOut = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+func emit(e event) {
+	if eventsOut == nil {
+		return
+	}
+
+	e.Time = time.Now()
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	_ = json.NewEncoder(eventsOut).Encode(e)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// startStep reports start of a step, returned func reports its end
+func startStep(name string) func(err error) {
+	emit(event{Kind: string(androidbuilder.EventStepStarted), Step: name})
+
+	start := time.Now()
+	return func(err error) {
+		emit(event{
+			Kind:     string(androidbuilder.EventStepFinished),
+			Step:     name,
+			Duration: time.Since(start).Seconds(),
+			Error:    errString(err),
+		})
+	}
+}
+
+func warn(format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	if eventsOut == nil {
+		fmt.Fprintln(os.Stderr, "warning:", msg)
+		return
+	}
+
+	emit(event{Kind: string(androidbuilder.EventWarning), Message: msg})
+}
+
+// info prints a progress message, it is dropped with -q and sent as a
+// "message" event with -json
+func info(format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	if eventsOut != nil {
+		emit(event{Kind: "message", Message: msg})
+		return
+	}
+
+	if !quiet {
+		fmt.Println(msg)
+	}
+}
+
+// logger returns the androidbuilder logger for -q and -v
+func logger() *androidbuilder.Logger {
+	l := &androidbuilder.Logger{Stdout: os.Stdout, Stderr: os.Stderr}
+	switch {
+	case quiet:
+		l.Level = androidbuilder.LogQuiet
+	case verbose:
+		l.Level = androidbuilder.LogVerbose
+	}
+	return l
+}
+
+func echo(cmd *exec.Cmd) {
+	if !quiet {
+		fmt.Println(cmd.String())
+	}
+}
+
+// runCmd prints and runs cmd, and reports it as an event
+func runCmd(step string, cmd *exec.Cmd) error {
+	echo(cmd)
+
+	start := time.Now()
+	err := cmd.Run()
+	emitCommand(step, cmd, start, err)
+	return err
+}
+
+// runCmdContext is like runCmd, when ctx is done cmd is killed along with
+// the processes it started
+func runCmdContext(ctx context.Context, step string, cmd *exec.Cmd) error {
+	echo(cmd)
+
+	start := time.Now()
+	err := androidbuilder.RunContext(ctx, cmd)
+	emitCommand(step, cmd, start, err)
+	return err
+}
+
+// outputCmd is like runCmd, but returns stdout of cmd
+func outputCmd(step string, cmd *exec.Cmd) ([]byte, error) {
+	echo(cmd)
+
+	start := time.Now()
+	out, err := cmd.Output()
+	emitCommand(step, cmd, start, err)
+	return out, err
+}
+
+func emitCommand(step string, cmd *exec.Cmd, start time.Time, err error) {
+	emit(event{
+		Kind:     string(androidbuilder.EventCommand),
+		Step:     step,
+		Command:  cmd.Args,
+		Duration: time.Since(start).Seconds(),
+		Error:    errString(err),
+	})
+}
+
+// builderEvents forwards androidbuilder events to the event stream
+func builderEvents(e androidbuilder.Event) {
+	emit(event{
+		Kind:     string(e.Kind),
+		Step:     e.Step,
+		Command:  e.Command,
+		Duration: e.Duration.Seconds(),
+		Message:  e.Message,
+		Error:    errString(e.Err),
+	})
+}
+
+func emitError(err error, kind errorKind, hint string) {
+	emit(event{
+		Kind:      "error",
+		Error:     err.Error(),
+		ErrorKind: kind.String(),
+		Hint:      hint,
+		ExitCode:  kind.exitCode(),
+	})
+}
+
+func emitArtifact(file, target string) error {
+	if eventsOut == nil {
+		return nil
+	}
+
+	buildType := "debug"
+	if release {
+		buildType = "release"
+	}
+
+	a := &artifact{
+		Path:      file,
+		Target:    target,
+		BuildType: buildType,
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("emitArtifact: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	a.Size, err = io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("emitArtifact: %w", err)
+	}
+	a.Sha256 = hex.EncodeToString(h.Sum(nil))
+
+	if target == "apk" || target == "appbundle" {
+		a.ABIs, err = abisInArchive(file)
+		if err != nil {
+			return fmt.Errorf("emitArtifact: %w", err)
+		}
+	}
+
+	emit(event{Kind: "artifact", Artifact: a})
+	return nil
+}
+
+// abisInArchive lists abis of native libraries in apk or aab
+func abisInArchive(file string) ([]string, error) {
+	z, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	var abis []string
+	for _, f := range z.File {
+		// "lib/<abi>/libfoo.so" for apk, "<module>/lib/<abi>/libfoo.so" for aab
+		dir, name := path.Split(f.Name)
+		if !strings.HasSuffix(name, ".so") {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimSuffix(dir, "/"), "/")
+		if len(parts) < 2 || parts[len(parts)-2] != "lib" {
+			continue
+		}
+
+		abi := parts[len(parts)-1]
+		if !contains(abis, abi) {
+			abis = append(abis, abi)
+		}
+	}
+
+	return abis, nil
+}
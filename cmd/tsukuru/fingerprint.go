@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// fingerprints of inputs of the previous build are stored here,
+// outside of "target/android" which is cleaned by the custom backend
+var fingerprintsDir = filepath.Join("target", "cache")
+
+// directories in android directory that hold build outputs
+var androidOutputDirs = []string{"build", ".gradle", ".cxx", ".externalNativeBuild", ".idea"}
+
+type fingerprint struct {
+	h hash.Hash
+}
+
+func newFingerprint() *fingerprint {
+	return &fingerprint{h: sha256.New()}
+}
+
+func (f *fingerprint) add(parts ...string) {
+	for _, p := range parts {
+		io.WriteString(f.h, p)
+		f.h.Write([]byte{0})
+	}
+}
+
+func (f *fingerprint) addFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	f.add(name)
+	_, err = io.Copy(f.h, file)
+	return err
+}
+
+func (f *fingerprint) sum() string {
+	return hex.EncodeToString(f.h.Sum(nil))
+}
+
+// upToDate reports whether sum matches the fingerprint stored in file,
+// and the artifact built from it still exists
+func upToDate(file, sum string) (artifact string, ok bool) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+
+	stored, artifact, _ := strings.Cut(string(b), "\n")
+	if stored != sum || artifact == "" {
+		return "", false
+	}
+
+	_, err = os.Stat(artifact)
+	if err != nil {
+		return "", false
+	}
+
+	return artifact, true
+}
+
+func writeFingerprint(file, sum, artifact string) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return fmt.Errorf("writeFingerprint: %w", err)
+	}
+
+	err = os.WriteFile(file, []byte(sum+"\n"+artifact), 0644)
+	if err != nil {
+		return fmt.Errorf("writeFingerprint: %w", err)
+	}
+
+	return nil
+}
+
+// goBuildFingerprintBase returns inputs shared by builds of every GOARCH,
+// version of go and ndk
+func goBuildFingerprintBase(ndkDir string) ([]string, error) {
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return nil, fmt.Errorf("goBuildFingerprintBase: %w", err)
+	}
+
+	return []string{
+		strings.TrimSpace(string(out)),
+		ndkDir,
+		androidbuilder.NdkRevision(ndkDir),
+	}, nil
+}
+
+// goBuildFingerprint hashes flags and environment of job, go environment,
+// and contents of every non standard library package it depends on
+func goBuildFingerprint(job goBuildJob) (string, error) {
+	f := newFingerprint()
+	f.add(job.fingerprintBase...)
+	f.add(job.args...)
+	f.add(job.env...)
+
+	// go build also reads the environment and "go env -w" settings that
+	// job.env doesn't override, e.g. GOFLAGS, CGO_CFLAGS or GOTOOLCHAIN
+	env := exec.Command("go", "env", "-json")
+	env.Env = append(os.Environ(), job.env...)
+	out, err := env.Output()
+	if err != nil {
+		return "", fmt.Errorf("goBuildFingerprint: %w", err)
+	}
+	var goEnv map[string]string
+	err = json.Unmarshal(out, &goEnv)
+	if err != nil {
+		return "", fmt.Errorf("goBuildFingerprint: %w", err)
+	}
+	// holds a temporary directory that differs on every run
+	delete(goEnv, "GOGCCFLAGS")
+	keys := make([]string, 0, len(goEnv))
+	for k := range goEnv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f.add(k + "=" + goEnv[k])
+	}
+
+	args := []string{"list", "-deps", "-json"}
+	if job.tags != "" {
+		args = append(args, "-tags", job.tags)
+	}
+	args = append(args, job.pkg)
+
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), job.env...)
+	out, err = cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("goBuildFingerprint: %w", err)
+	}
+
+	type goPackage struct {
+		Dir      string
+		Standard bool
+		Module   *struct {
+			GoMod string
+		}
+
+		GoFiles, CgoFiles, CFiles, CXXFiles, MFiles, HFiles, FFiles, SFiles,
+		SwigFiles, SwigCXXFiles, SysoFiles, EmbedFiles []string
+	}
+
+	goMods := map[string]bool{}
+
+	d := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg goPackage
+		err := d.Decode(&pkg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("goBuildFingerprint: %w", err)
+		}
+
+		// standard library is covered by go version
+		if pkg.Standard {
+			continue
+		}
+
+		if pkg.Module != nil && pkg.Module.GoMod != "" {
+			goMods[pkg.Module.GoMod] = true
+		}
+
+		for _, files := range [][]string{
+			pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.MFiles, pkg.HFiles, pkg.FFiles, pkg.SFiles,
+			pkg.SwigFiles, pkg.SwigCXXFiles, pkg.SysoFiles, pkg.EmbedFiles,
+		} {
+			for _, file := range files {
+				err := f.addFile(filepath.Join(pkg.Dir, file))
+				if err != nil {
+					return "", fmt.Errorf("goBuildFingerprint: %w", err)
+				}
+			}
+		}
+	}
+
+	// go.mod files decide versions of dependencies
+	var sorted []string
+	for goMod := range goMods {
+		sorted = append(sorted, goMod)
+	}
+	sort.Strings(sorted)
+	for _, goMod := range sorted {
+		err := f.addFile(goMod)
+		if err != nil {
+			return "", fmt.Errorf("goBuildFingerprint: %w", err)
+		}
+	}
+
+	return f.sum(), nil
+}
+
+// androidDirFingerprint hashes contents of the android directory,
+// skipping build outputs, along with extra
+func androidDirFingerprint(dir string, extra ...string) (string, error) {
+	f := newFingerprint()
+	f.add(extra...)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dir && contains(androidOutputDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || d.Name() == "local.properties" {
+			return nil
+		}
+
+		return f.addFile(path)
+	})
+	if err != nil {
+		return "", fmt.Errorf("androidDirFingerprint: %w", err)
+	}
+
+	return f.sum(), nil
+}
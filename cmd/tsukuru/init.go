@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+//go:embed all:templates
+var templates embed.FS
+
+var (
+	// flags for init
+	appID          string
+	appName        string
+	minSdk         string
+	targetSdk      string
+	nativeActivity bool
+)
+
+type initData struct {
+	AppID     string
+	AppName   string
+	LibName   string
+	MinSdk    string
+	TargetSdk string
+	Backend   string
+
+	// generate an app without java sources using android.app.NativeActivity
+	NativeActivity bool
+
+	// prefix of go functions implementing native methods of MainActivity
+	JNIPrefix string
+}
+
+// initProject generates a new project in dir from embedded templates
+func initProject(dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+
+	if appID == "" {
+		return usageError("-appid is required")
+	}
+	err := validateAppID(appID)
+	if err != nil {
+		return usageError("invalid -appid %q: %w", appID, err)
+	}
+
+	if appName == "" {
+		parts := strings.Split(appID, ".")
+		appName = parts[len(parts)-1]
+	}
+	if strings.ContainsAny(appName, "\"\\") {
+		return usageError("-appname must not contain quotes or backslashes")
+	}
+
+	for _, v := range []struct{ name, value string }{{"minsdk", minSdk}, {"targetsdk", targetSdk}} {
+		if _, err := strconv.Atoi(v.value); err != nil {
+			return usageError("invalid -%s %q, expected an api level", v.name, v.value)
+		}
+	}
+
+	if androidBackend != "gradle" && androidBackend != "custom" {
+		return usageError("invalid android backend %q", androidBackend)
+	}
+
+	data := initData{
+		AppID:     appID,
+		AppName:   appName,
+		LibName:   libName,
+		MinSdk:    minSdk,
+		TargetSdk: targetSdk,
+		Backend:   androidBackend,
+
+		NativeActivity: nativeActivity,
+		JNIPrefix:      androidbuilder.JNIFunctionName(appID+".MainActivity", ""),
+	}
+
+	files, err := renderTemplates(data)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !force {
+		var existing []string
+		for _, name := range names {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if err == nil {
+				existing = append(existing, name)
+			}
+		}
+		if len(existing) > 0 {
+			return &cliError{
+				hint: "rerun with -force to overwrite them",
+				err:  fmt.Errorf("refusing to overwrite existing files in %s: %s", dir, strings.Join(existing, ", ")),
+			}
+		}
+	}
+
+	for _, name := range names {
+		f := files[name]
+		dst := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(dst), 0755)
+		if err != nil {
+			return fmt.Errorf("initProject: %w", err)
+		}
+
+		err = os.WriteFile(dst, f.content, f.mode)
+		if err != nil {
+			return fmt.Errorf("initProject: %w", err)
+		}
+		fmt.Println("created", dst)
+	}
+
+	fmt.Println()
+	if nativeActivity {
+		fmt.Println("add the nativeactivity package with: go get github.com/rajveermalviya/tsukuru/nativeactivity")
+	}
+	fmt.Println("build the app with: tsukuru build apk", dir)
+	return nil
+}
+
+type templateFile struct {
+	content []byte
+	mode    os.FileMode
+}
+
+// renderTemplates renders "common" templates, the templates of the
+// android backend and either "java" or "nativeactivity" templates, files
+// ending with ".tmpl" are executed with data, "__package__" in paths is
+// replaced by the package directory of data.AppID
+func renderTemplates(data initData) (map[string]templateFile, error) {
+	funcs := template.FuncMap{
+		"xml": func(s string) (string, error) {
+			var b bytes.Buffer
+			err := xml.EscapeText(&b, []byte(s))
+			return b.String(), err
+		},
+	}
+
+	files := map[string]templateFile{}
+
+	app := "java"
+	if data.NativeActivity {
+		app = "nativeactivity"
+	}
+
+	for _, root := range []string{"common", data.Backend, app} {
+		root = path.Join("templates", root)
+		if _, err := fs.Stat(templates, root); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		err := fs.WalkDir(templates, root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			content, err := templates.ReadFile(p)
+			if err != nil {
+				return err
+			}
+
+			name := strings.TrimPrefix(p, root+"/")
+			name = strings.ReplaceAll(name, "__package__", strings.ReplaceAll(data.AppID, ".", "/"))
+			if path.Base(name) == "gitignore" {
+				name = path.Join(path.Dir(name), ".gitignore")
+			}
+
+			if strings.HasSuffix(name, ".tmpl") {
+				name = strings.TrimSuffix(name, ".tmpl")
+
+				t, err := template.New(name).Funcs(funcs).Parse(string(content))
+				if err != nil {
+					return err
+				}
+
+				var b bytes.Buffer
+				err = t.Execute(&b, data)
+				if err != nil {
+					return err
+				}
+				content = b.Bytes()
+			}
+
+			mode := os.FileMode(0644)
+			if path.Base(name) == "gradlew" {
+				mode = 0755
+			}
+
+			files[filepath.FromSlash(name)] = templateFile{content: content, mode: mode}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("renderTemplates: %w", err)
+		}
+	}
+
+	return files, nil
+}
+
+// validateAppID checks that id is a valid java package name with at least
+// two segments, as required for android application ids
+func validateAppID(id string) error {
+	parts := strings.Split(id, ".")
+	if len(parts) < 2 {
+		return errors.New("should have at least two segments, e.g. com.example.app")
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return errors.New("empty segment")
+		}
+		if contains(javaKeywords, part) {
+			return errors.New("segment " + part + " is a java keyword")
+		}
+
+		// android only accepts [A-Za-z][A-Za-z0-9_]*
+		for i, r := range part {
+			if i == 0 && !isASCIILetter(r) {
+				return errors.New("segment " + part + " should start with a letter")
+			}
+			if !isASCIILetter(r) && !('0' <= r && r <= '9') && r != '_' {
+				return errors.New("segment " + part + " contains invalid character " + strconv.QuoteRune(r))
+			}
+		}
+	}
+
+	return nil
+}
+
+func isASCIILetter(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
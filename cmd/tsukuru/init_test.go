@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestValidateAppID(t *testing.T) {
+	tests := []struct {
+		id string
+		ok bool
+	}{
+		{"com.example.app", true},
+		{"com.example.my_app", true},
+		{"io.github.user2.App", true},
+		{"app", false},
+		{"com..app", false},
+		{"com.example.", false},
+		{".com.example", false},
+		{"com.example.2app", false},
+		{"com.example._app", false},
+		{"com.example.my-app", false},
+		{"com.example.café", false},
+		{"com.example.new", false},
+		{"com.class.app", false},
+		{"com.example.null", false},
+	}
+
+	for _, tt := range tests {
+		err := validateAppID(tt.id)
+		if (err == nil) != tt.ok {
+			t.Errorf("validateAppID(%q) = %v, want ok=%v", tt.id, err, tt.ok)
+		}
+	}
+}
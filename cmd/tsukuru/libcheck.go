@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// shippedLibrary is a shared library packaged in jniLibs
+type shippedLibrary struct {
+	path      string
+	toolchain *androidbuilder.NDKToolchain
+}
+
+// checkLibraries inspects shared libraries before they are packaged,
+// libraries not aligned for 16 KB pages always fail the build, other
+// problems are only warned about with -libwarnings
+func checkLibraries(shipped []shippedLibrary) error {
+	systemLibs := map[string][]string{}
+
+	var errs []error
+	for _, lib := range shipped {
+		err := androidbuilder.CheckPageAlignment(lib.path, androidbuilder.PageSize16K)
+		if err != nil {
+			return err
+		}
+
+		abi := lib.toolchain.ABI.Name
+		if _, ok := systemLibs[abi]; !ok {
+			systemLibs[abi], err = lib.toolchain.SystemLibraries()
+			if err != nil {
+				return err
+			}
+		}
+
+		// other libraries in jniLibs/<abi> are packaged along with it
+		available := append([]string(nil), systemLibs[abi]...)
+		entries, err := os.ReadDir(filepath.Dir(lib.path))
+		if err != nil {
+			return fmt.Errorf("checkLibraries: %w", err)
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".so") {
+				available = append(available, entry.Name())
+			}
+		}
+
+		problems, err := androidbuilder.CheckLibrary(lib.path, available)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range problems {
+			if libWarnings {
+				warn("%s: %v", abi, p)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", abi, p))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	// classified by the first problem, the rest are listed after it
+	var rest strings.Builder
+	for _, err := range errs[1:] {
+		rest.WriteString("\n\t" + err.Error())
+	}
+	return fmt.Errorf("checkLibraries: %w%s", errs[0], rest.String())
+}
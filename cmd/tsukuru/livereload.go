@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// path of the server-sent events endpoint, reload events are sent
+// to open pages after every build
+const liveReloadPath = "/_tsukuru/events"
+
+// injected into served html pages
+const liveReloadScript = `<script>
+new EventSource("` + liveReloadPath + `").addEventListener("reload", () => location.reload());
+</script>
+`
+
+// liveReloadServer serves the wasm output directory, injecting
+// liveReloadScript in index.html, and the compile error of the last build
+// in place of the page if it failed
+type liveReloadServer struct {
+	dir   string
+	files http.Handler
+
+	// held for writing while building, so that requests
+	// don't see a partially written output directory
+	buildMu  sync.RWMutex
+	buildErr string
+
+	clientsMu sync.Mutex
+	clients   map[chan struct{}]struct{}
+}
+
+func newLiveReloadServer(dir string) *liveReloadServer {
+	return &liveReloadServer{
+		dir:     dir,
+		files:   http.FileServer(http.Dir(dir)),
+		clients: map[chan struct{}]struct{}{},
+	}
+}
+
+func (s *liveReloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == liveReloadPath {
+		s.serveEvents(w, r)
+		return
+	}
+
+	s.buildMu.RLock()
+	defer s.buildMu.RUnlock()
+
+	// every build produces new files
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch {
+	case r.URL.Path == "/" || r.URL.Path == "/index.html":
+		s.serveIndex(w)
+
+	case s.buildErr != "" && strings.HasSuffix(r.URL.Path, ".wasm"):
+		// never serve a stale module
+		http.Error(w, s.buildErr, http.StatusServiceUnavailable)
+
+	default:
+		s.files.ServeHTTP(w, r)
+	}
+}
+
+func (s *liveReloadServer) serveIndex(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if s.buildErr != "" {
+		fmt.Fprintf(w, "<!doctype html>\n<html>\n<head><meta charset=\"utf-8\"><title>build failed</title></head>\n"+
+			"<body>\n<h1>build failed</h1>\n<pre>%s</pre>\n%s</body>\n</html>\n",
+			html.EscapeString(s.buildErr), liveReloadScript)
+		return
+	}
+
+	b, err := os.ReadFile(filepath.Join(s.dir, "index.html"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if i := bytes.LastIndex(b, []byte("</body>")); i != -1 {
+		b = append(b[:i:i], append([]byte(liveReloadScript), b[i:]...)...)
+	} else {
+		b = append(b, liveReloadScript...)
+	}
+	w.Write(b)
+}
+
+func (s *liveReloadServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	reload := make(chan struct{}, 1)
+	s.clientsMu.Lock()
+	s.clients[reload] = struct{}{}
+	s.clientsMu.Unlock()
+
+	defer func() {
+		s.clientsMu.Lock()
+		delete(s.clients, reload)
+		s.clientsMu.Unlock()
+	}()
+
+	// comment line, so that the response starts immediately
+	io.WriteString(w, ": connected\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-reload:
+			io.WriteString(w, "event: reload\ndata: \n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// reload asks every open page to reload
+func (s *liveReloadServer) reload() {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	for c := range s.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// build runs build while holding requests, and records its compile error
+func (s *liveReloadServer) build(build func(stderr io.Writer) error) {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+
+	var stderr bytes.Buffer
+	err := build(io.MultiWriter(os.Stderr, &stderr))
+	if err != nil {
+		printError(err)
+		s.buildErr = strings.TrimSpace(stderr.String() + "\n" + err.Error())
+		return
+	}
+	s.buildErr = ""
+}
+
+// watchWasm serves the wasm build of mainPackagePath, rebuilding it every
+// time its go dependencies change and reloading open pages
+func watchWasm(ctx context.Context, mainPackagePath string) error {
+	s := newLiveReloadServer(filepath.Join("target", "wasm"))
+	w := &watcher{}
+
+	build := func() {
+		dirs, err := goDepDirs([]string{mainPackagePath}, "GOOS=js", "GOARCH=wasm")
+		if err != nil {
+			printError(err)
+			if len(w.dirs) == 0 {
+				w.dirs = fallbackWatchDirs([]string{mainPackagePath})
+			}
+		} else {
+			w.dirs = dirs
+		}
+
+		// snapshot before building, so that changes made
+		// during the build trigger another one
+		w.snapshot()
+
+		s.build(func(stderr io.Writer) error {
+			_, err := buildWasm(ctx, mainPackagePath, "test.wasm", stderr)
+			if err != nil {
+				return err
+			}
+			return copyWasmSupportFiles(s.dir)
+		})
+		s.reload()
+	}
+
+	build()
+
+	go func() {
+		for {
+			err := w.wait(ctx)
+			if err != nil {
+				return
+			}
+
+			info("Change detected, rebuilding")
+			build()
+		}
+	}()
+
+	fmt.Printf("serving %s at %s, watching for changes\n", s.dir, addr)
+	return serve(ctx, s)
+}
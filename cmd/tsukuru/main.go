@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"go/build"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 )
 
 var (
@@ -16,6 +21,8 @@ var (
 
 	androidBackend string
 	libName        string
+	libs           string
+	buildMode      string
 	ldflags        string
 	release        bool
 	download       bool
@@ -25,9 +32,29 @@ var (
 	race           bool
 	tags           string
 	skipcheckin    bool
+	parallel       int
+	force          bool
+	quiet          bool
+	verbose        bool
+	abiFlags       abiSettings
+	ndkVersion     string
+	libWarnings    bool
+
+	// named profile from tsukurufile
+	profile string
+
+	// for run apk and run wasm
+	watch bool
 
 	// for run wasm server
 	addr string
+
+	// for symbolize
+	symbols  string
+	crashABI string
+
+	// for test android
+	adbPath string
 )
 
 var (
@@ -37,6 +64,17 @@ var (
 	buildWasmCmd      = flag.NewFlagSet("build wasm", flag.ExitOnError)
 	runWasmCmd        = flag.NewFlagSet("run wasm", flag.ExitOnError)
 	checkinCmd        = flag.NewFlagSet("checkin deps", flag.ExitOnError)
+	doctorCmd         = flag.NewFlagSet("doctor", flag.ExitOnError)
+	initCmd           = flag.NewFlagSet("init", flag.ExitOnError)
+	symbolizeCmd      = flag.NewFlagSet("symbolize", flag.ExitOnError)
+	testAndroidCmd    = flag.NewFlagSet("test android", flag.ExitOnError)
+	vetCmd            = flag.NewFlagSet("vet", flag.ExitOnError)
+	bindJavaCmd       = flag.NewFlagSet("bind java", flag.ExitOnError)
+
+	allCmds = []*flag.FlagSet{buildApkCmd, buildAppbundleCmd, runApkCmd, buildWasmCmd, runWasmCmd, checkinCmd, doctorCmd, initCmd, symbolizeCmd, testAndroidCmd, vetCmd, bindJavaCmd}
+
+	// commands that don't take a subcommand
+	singleWordCmds = []string{"doctor", "init", "symbolize", "vet"}
 )
 
 func init() {
@@ -45,6 +83,12 @@ func init() {
 		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru build {apk, appbundle, wasm} [-options] <path to main package>\n\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru run {apk, wasm} [-options] <path to main package>\n\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru checkin deps [-options] <path to main package>\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru test android [-options] <packages> [-- test binary flags]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru vet [-options] <path to main package>\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru bind java [-options] <path to package>\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru doctor [-options] [path to main package]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru init -appid <application id> [-options] [directory]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "\ttsukuru symbolize [-options] [tombstone or logcat file, default stdin]\n\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "Run 'tsukuru [command] [subcommand] -help' for details\n\n")
 		flag.PrintDefaults()
 	}
@@ -52,85 +96,237 @@ func init() {
 	// setup common flags
 	for _, c := range []*flag.FlagSet{buildApkCmd, buildAppbundleCmd, runApkCmd, buildWasmCmd, runWasmCmd} {
 		c.StringVar(&ldflags, "ldflags", "", "")
-		c.BoolVar(&release, "release", false, "currently ignored by \"custom\" android backend")
+		c.BoolVar(&release, "release", false, "release build, ships stripped libraries and keeps unstripped ones in target/symbols")
 		c.BoolVar(&x, "x", false, "")
 		c.BoolVar(&a, "a", false, "")
 		c.BoolVar(&race, "race", false, "")
 		c.StringVar(&tags, "tags", "", "")
+		c.StringVar(&profile, "profile", "", "name of the build profile from tsukurufile to use")
+	}
+
+	for _, c := range []*flag.FlagSet{buildApkCmd, buildAppbundleCmd, runApkCmd, buildWasmCmd, runWasmCmd, checkinCmd, testAndroidCmd} {
+		c.BoolVar(&quiet, "q", false, "don't print commands, output of tools is shown only if they fail")
+		c.BoolVar(&verbose, "v", false, "print output of every tool while it runs")
+	}
+
+	for _, c := range []*flag.FlagSet{buildApkCmd, buildAppbundleCmd, runApkCmd, doctorCmd, vetCmd, bindJavaCmd} {
+		c.StringVar(&androidDir, "androiddir", "", "android directory (default \"android\")")
 	}
 
 	// setup common android flags
 	for _, c := range []*flag.FlagSet{buildApkCmd, buildAppbundleCmd, runApkCmd} {
-		c.StringVar(&androidDir, "androiddir", "", "android directory (default \"android\")")
 		c.StringVar(&androidBackend, "androidbackend", "gradle", "builder backend for android, possible values are \"custom\" (experimental), \"gradle\"")
-		c.StringVar(&libName, "libname", "main", "name of the shared library, should be exactly same name as passed in System.loadLibrary()")
+		c.StringVar(&libName, "libname", "main", "name of the shared library, should be exactly same name as passed in System.loadLibrary() or android.app.lib_name of a NativeActivity")
+		c.StringVar(&buildMode, "buildmode", "c-shared", "how go libraries are built, \"c-shared\" into jniLibs, or \"c-archive\" into static archives in app/src/main/golibs for externalNativeBuild")
+		c.StringVar(&libs, "libs", "", "comma separated list of <package>=<libname> pairs, built into lib<libname>.so along with the main package")
 		c.BoolVar(&download, "download", true, "automatically download missing sdks")
 		c.StringVar(&goarches, "goarches", "arm64,arm,amd64,386", "comma separated list (no spaces) of GOARCH to include in apk")
 		c.BoolVar(&skipcheckin, "skipcheckin", false, "")
+		c.IntVar(&parallel, "p", runtime.NumCPU(), "number of GOARCH to build in parallel")
+		c.BoolVar(&force, "force", false, "rebuild shared libraries and repackage even if nothing changed")
+		c.BoolVar(&libWarnings, "libwarnings", false, "report missing dependencies, JNI entry points and text relocations of built libraries as warnings instead of failing the build")
+		c.StringVar(&ndkVersion, "ndkversion", "", "version of the ndk to use (default ndkVersion from build.gradle, then ANDROID_NDK_HOME, then the latest installed)")
+		c.Var(&abiFlags, "abi", "per GOARCH setting in the form <goarch>.<key>=<value>, can be repeated, keys: "+strings.Join(abiKeys, ", "))
 	}
 
+	for _, c := range allCmds {
+		c.BoolVar(&jsonOutput, "json", false, "write newline delimited json events to stdout, output of tools goes to stderr")
+	}
+
+	checkinCmd.StringVar(&libs, "libs", "", "comma separated list of <package>=<libname> pairs, built along with the main package")
+
+	doctorCmd.StringVar(&ndkVersion, "ndkversion", "", "version of the ndk to check for (default ndkVersion from build.gradle, then ANDROID_NDK_HOME, then the latest installed)")
+
+	runApkCmd.BoolVar(&watch, "watch", false, "rebuild, reinstall and restart the app when go dependencies or android directory change")
+
 	runWasmCmd.StringVar(&addr, "addr", ":8080", "")
+	runWasmCmd.BoolVar(&watch, "watch", false, "rebuild when go dependencies change and reload open pages")
+
+	initCmd.StringVar(&appID, "appid", "", "application id of the app, e.g. com.example.app")
+	initCmd.StringVar(&appName, "appname", "", "name of the app (default last segment of -appid)")
+	initCmd.StringVar(&libName, "libname", "main", "name of the shared library loaded via System.loadLibrary(), or android.app.lib_name with -nativeactivity")
+	initCmd.StringVar(&minSdk, "minsdk", "21", "minSdkVersion of the app")
+	initCmd.StringVar(&targetSdk, "targetsdk", "33", "targetSdkVersion of the app")
+	initCmd.StringVar(&androidBackend, "androidbackend", "gradle", "builder backend for android the project is generated for, possible values are \"custom\" (experimental), \"gradle\"")
+	initCmd.BoolVar(&nativeActivity, "nativeactivity", false, "generate an app without java sources, using android.app.NativeActivity and the nativeactivity package")
+	initCmd.BoolVar(&force, "force", false, "overwrite existing files")
+
+	testAndroidCmd.StringVar(&adbPath, "adb", "", "adb to run the tests with, e.g. a stand-in for CI without a device (default platform-tools/adb of the android sdk)")
+	testAndroidCmd.StringVar(&androidDir, "androiddir", "", "android directory to take minSdkVersion and ndkVersion from")
+	testAndroidCmd.StringVar(&minSdk, "minsdk", "21", "API level the tests are compiled for, if -androiddir is not set")
+	testAndroidCmd.StringVar(&ndkVersion, "ndkversion", "", "version of the ndk to use (default ndkVersion from build.gradle, then ANDROID_NDK_HOME, then the latest installed)")
+	testAndroidCmd.BoolVar(&download, "download", true, "automatically download missing ndk")
+	testAndroidCmd.Var(&abiFlags, "abi", "per GOARCH setting in the form <goarch>.<key>=<value>, can be repeated, keys: "+strings.Join(abiKeys, ", "))
+	testAndroidCmd.StringVar(&ldflags, "ldflags", "", "")
+	testAndroidCmd.StringVar(&tags, "tags", "", "")
+	testAndroidCmd.BoolVar(&x, "x", false, "")
+	testAndroidCmd.BoolVar(&a, "a", false, "")
+
+	vetCmd.StringVar(&libName, "libname", "main", "name of the shared library built from the main package")
+	vetCmd.StringVar(&libs, "libs", "", "comma separated list of <package>=<libname> pairs, built along with the main package")
+	vetCmd.StringVar(&tags, "tags", "", "")
+	vetCmd.StringVar(&profile, "profile", "", "name of the build profile from tsukurufile to use")
+
+	bindJavaCmd.StringVar(&libName, "libname", "main", "name of the shared library the package is built into, loaded by the generated classes")
+	bindJavaCmd.StringVar(&tags, "tags", "", "")
+
+	symbolizeCmd.StringVar(&symbols, "symbols", symbolsDir, "directory of unstripped libraries, as kept by -release builds")
+	symbolizeCmd.StringVar(&crashABI, "abi", "", "android abi of the crashed app, e.g. arm64-v8a (default detected from the input)")
+	symbolizeCmd.StringVar(&libName, "libname", "main", "name of the shared library Go tracebacks are symbolized with")
 }
 
 func fail() {
 	flag.Usage()
-	os.Exit(1)
+	os.Exit(kindUsage.exitCode())
 }
 
 func main() {
-	if len(os.Args) < 3 {
+	if len(os.Args) < 2 {
 		fail()
 	}
 
-	mainCmd := os.Args[1]
-	subCmd := os.Args[2]
+	// on interrupt running tools are killed and partial outputs removed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args[1], os.Args[2:])
+	stop()
+	if err != nil {
+		exit(err)
+	}
+}
+
+func run(ctx context.Context, mainCmd string, args []string) error {
+	var subCmd string
+	if !contains(singleWordCmds, mainCmd) {
+		if len(args) == 0 {
+			return usageError("missing subcommand for %q", mainCmd)
+		}
+		subCmd, args = args[0], args[1:]
+	}
 
-	var mainPackagePath string
+	var (
+		fset *flag.FlagSet
+		// build target used to pick settings from tsukurufile
+		target string
+	)
 
 	switch {
 	case mainCmd == "build" && subCmd == "apk":
-		buildApkCmd.Parse(os.Args[3:])
-		mainPackagePath = buildApkCmd.Arg(0)
+		fset, target = buildApkCmd, "apk"
 
 	case mainCmd == "build" && subCmd == "appbundle":
-		buildAppbundleCmd.Parse(os.Args[3:])
-		mainPackagePath = buildAppbundleCmd.Arg(0)
+		fset, target = buildAppbundleCmd, "appbundle"
 
 	case mainCmd == "run" && subCmd == "apk":
-		runApkCmd.Parse(os.Args[3:])
-		mainPackagePath = runApkCmd.Arg(0)
+		fset, target = runApkCmd, "apk"
 
 	case mainCmd == "build" && subCmd == "wasm":
-		buildWasmCmd.Parse(os.Args[3:])
-		mainPackagePath = buildWasmCmd.Arg(0)
+		fset, target = buildWasmCmd, "wasm"
 
 	case mainCmd == "run" && subCmd == "wasm":
-		runWasmCmd.Parse(os.Args[3:])
-		mainPackagePath = runWasmCmd.Arg(0)
+		fset, target = runWasmCmd, "wasm"
 
 	case mainCmd == "checkin" && subCmd == "deps":
-		checkinCmd.Parse(os.Args[3:])
-		mainPackagePath = checkinCmd.Arg(0)
+		fset = checkinCmd
+
+	case mainCmd == "doctor":
+		fset = doctorCmd
+
+	case mainCmd == "init":
+		fset = initCmd
+
+	case mainCmd == "symbolize":
+		fset = symbolizeCmd
+
+	case mainCmd == "test" && subCmd == "android":
+		fset = testAndroidCmd
+
+	case mainCmd == "bind" && subCmd == "java":
+		fset = bindJavaCmd
+
+	case mainCmd == "vet":
+		// picks libs and tags of apk builds from tsukurufile
+		fset, target = vetCmd, "apk"
 
 	default:
-		fail()
-		return
+		return usageError("unknown command %q", strings.TrimSpace(mainCmd+" "+subCmd))
+	}
+
+	fset.Parse(args)
+	mainPackagePath := fset.Arg(0)
+
+	if jsonOutput {
+		setupJSONOutput()
+	}
+
+	if doctorCmd.Parsed() {
+		return doctor(mainPackagePath)
+	}
+
+	if initCmd.Parsed() {
+		return initProject(fset.Arg(0))
+	}
+
+	if symbolizeCmd.Parsed() {
+		return symbolizeFile(fset.Arg(0))
+	}
+
+	if testAndroidCmd.Parsed() {
+		if quiet && verbose {
+			return usageError("-q and -v are mutually exclusive")
+		}
+
+		// flags after "--" are passed to the test binaries
+		patterns, testArgs := fset.Args(), []string(nil)
+		if i := indexOf(patterns, "--"); i >= 0 {
+			patterns, testArgs = patterns[:i], patterns[i+1:]
+		}
+		if len(patterns) == 0 {
+			patterns = []string{"."}
+		}
+		return testAndroid(ctx, patterns, testArgs)
 	}
 
 	wd, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	pkg, err := build.Import(mainPackagePath, wd, build.FindOnly)
 	if err != nil {
-		fmt.Println(err)
-		fail()
-		return
+		return usageError("%w", err)
 	}
 
 	mainPackagePath = pkg.Dir
 
+	if target != "" {
+		config, err := readBuildConfig(filepath.Join(mainPackagePath, "tsukurufile"))
+		if err != nil {
+			return err
+		}
+
+		settings, err := config.settings(target, profile)
+		if err != nil {
+			return err
+		}
+
+		err = applyBuildConfig(fset, settings, config.path)
+		if err != nil {
+			return err
+		}
+
+		// -abi settings replace the ones from tsukurufile
+		abiFlags = overrideABISettings(config.abis, abiFlags)
+
+		// -json may have been enabled by tsukurufile
+		if jsonOutput && eventsOut == nil {
+			setupJSONOutput()
+		}
+	}
+
+	if quiet && verbose {
+		return usageError("-q and -v are mutually exclusive")
+	}
+
 	switch {
 	case buildApkCmd.Parsed():
 		if androidDir == "" {
@@ -138,9 +334,13 @@ func main() {
 		}
 
 		if !skipcheckin {
-			checkin(mainPackagePath)
+			err := checkin(mainPackagePath)
+			if err != nil {
+				return err
+			}
 		}
-		_ = buildAndroid(mainPackagePath, "apk")
+		_, err := buildAndroid(ctx, mainPackagePath, "apk")
+		return err
 
 	case buildAppbundleCmd.Parsed():
 		if androidDir == "" {
@@ -148,29 +348,75 @@ func main() {
 		}
 
 		if !skipcheckin {
-			checkin(mainPackagePath)
+			err := checkin(mainPackagePath)
+			if err != nil {
+				return err
+			}
 		}
-		_ = buildAndroid(mainPackagePath, "appbundle")
+		_, err := buildAndroid(ctx, mainPackagePath, "appbundle")
+		return err
 
 	case runApkCmd.Parsed():
 		if androidDir == "" {
 			androidDir = filepath.Join(mainPackagePath, "android")
 		}
 
+		if watch {
+			return watchAndroid(ctx, mainPackagePath)
+		}
+
 		if !skipcheckin {
-			checkin(mainPackagePath)
+			err := checkin(mainPackagePath)
+			if err != nil {
+				return err
+			}
 		}
-		out := buildAndroid(mainPackagePath, "apk")
-		runAndroid(out)
+		out, err := buildAndroid(ctx, mainPackagePath, "apk")
+		if err != nil {
+			return err
+		}
+		return runAndroid(ctx, out)
 
 	case buildWasmCmd.Parsed():
-		_ = buildWasm(mainPackagePath, "main.wasm")
+		_, err := buildWasm(ctx, mainPackagePath, "main.wasm", os.Stderr)
+		return err
 
 	case runWasmCmd.Parsed():
-		out := buildWasm(mainPackagePath, "test.wasm")
-		runWasm(out)
+		if watch {
+			return watchWasm(ctx, mainPackagePath)
+		}
+
+		out, err := buildWasm(ctx, mainPackagePath, "test.wasm", os.Stderr)
+		if err != nil {
+			return err
+		}
+		return runWasm(ctx, out)
+
+	case vetCmd.Parsed():
+		if androidDir == "" {
+			androidDir = filepath.Join(mainPackagePath, "android")
+		}
+
+		libs, err := androidLibraries(mainPackagePath)
+		if err != nil {
+			return err
+		}
+		return vet(libs)
+
+	case bindJavaCmd.Parsed():
+		if androidDir == "" {
+			androidDir = filepath.Join(mainPackagePath, "android")
+		}
+
+		return bindJava(mainPackagePath)
 
 	case checkinCmd.Parsed():
-		checkin(mainPackagePath)
+		if androidDir == "" {
+			androidDir = filepath.Join(mainPackagePath, "android")
+		}
+
+		return checkin(mainPackagePath)
 	}
+
+	return nil
 }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+type goBuildJob struct {
+	goarch string
+	// file name of the library, set only when building several of them
+	lib    string
+	pkg    string
+	output string
+	// passed to -tags
+	tags string
+
+	args []string
+	// added to os.Environ()
+	env []string
+
+	// if set, build is skipped when the fingerprint of its inputs
+	// matches the one stored in fingerprintFile
+	fingerprintBase []string
+	fingerprintFile string
+}
+
+// label identifies the job in logs
+func (j goBuildJob) label() string {
+	if j.lib == "" {
+		return j.goarch
+	}
+	return j.goarch + " " + j.lib
+}
+
+// buildErrors holds failures of all jobs that were not cancelled
+type buildErrors []error
+
+func (e buildErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e buildErrors) Unwrap() []error { return e }
+
+// runGoBuilds runs go build for every job, at most n at a time.
+// Output of every job is prefixed with its label, failure of one job
+// cancels the remaining ones.
+func runGoBuilds(parent context.Context, jobs []goBuildJob, n int) error {
+	if n < 1 {
+		n = 1
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs buildErrors
+		sem  = make(chan struct{}, n)
+	)
+
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job goBuildJob) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			var fingerprint string
+			if job.fingerprintFile != "" {
+				var err error
+				fingerprint, err = goBuildFingerprint(job)
+				if err != nil {
+					warn("unable to fingerprint inputs of [%s]: %v", job.label(), err)
+				} else if _, ok := upToDate(job.fingerprintFile, fingerprint); ok {
+					info("[%s] %s is up to date", job.label(), job.output)
+					return
+				}
+			}
+
+			stdout := newPrefixWriter(os.Stdout, "["+job.label()+"] ")
+			stderr := newPrefixWriter(os.Stderr, "["+job.label()+"] ")
+
+			cmd := exec.Command("go", job.args...)
+			cmd.Env = append(os.Environ(), job.env...)
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+
+			step := "go build GOOS=android GOARCH=" + job.label()
+			done := startStep(step)
+			err := runCmdContext(ctx, step, cmd)
+			done(err)
+
+			stdout.Flush()
+			stderr.Flush()
+
+			if err == nil {
+				if fingerprint != "" {
+					err = writeFingerprint(job.fingerprintFile, fingerprint, job.output)
+					if err != nil {
+						warn("%v", err)
+					}
+				}
+				return
+			}
+
+			if job.fingerprintFile != "" {
+				_ = os.Remove(job.fingerprintFile)
+			}
+
+			// ignore jobs killed because some other job failed,
+			// jobs that failed by themselves meanwhile are still reported
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				return
+			}
+
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("go build [%s]: %w", job.label(), err))
+			mu.Unlock()
+
+			cancel()
+		}(job)
+	}
+
+	wg.Wait()
+
+	// every job was killed
+	if err := parent.Err(); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return compileError(errs)
+	}
+	return nil
+}
+
+// all prefixWriters write whole lines under this lock,
+// so that lines of concurrent jobs don't interleave
+var prefixMu sync.Mutex
+
+// prefixWriter writes every line to w prefixed with prefix
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    bytes.Buffer
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i == -1 {
+			break
+		}
+
+		line := p.buf.Next(i + 1)
+		err := p.writeLine(line)
+		if err != nil {
+			return len(b), err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the remaining incomplete line
+func (p *prefixWriter) Flush() error {
+	if p.buf.Len() == 0 {
+		return nil
+	}
+
+	line := append(p.buf.Bytes(), '\n')
+	p.buf.Reset()
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	prefixMu.Lock()
+	defer prefixMu.Unlock()
+
+	_, err := io.WriteString(p.w, p.prefix)
+	if err != nil {
+		return err
+	}
+	_, err = p.w.Write(line)
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeGo fails every build. With FAKE_GO_SLOW set, it exits right away but a
+// child keeps its stdout open, so that go build is only waited for after
+// the failure of the other job cancelled it, and fails once that happened.
+const fakeGo = `#!/bin/sh
+if [ -n "$FAKE_GO_SLOW" ]; then
+	(
+		while kill -0 $$ 2>/dev/null; do sleep 0.01; done
+		touch "$FAKE_GO_DIR/slow-exited"
+		sleep 60
+	) &
+	echo "slow failure" >&2
+	exit 1
+fi
+
+while [ ! -e "$FAKE_GO_DIR/slow-exited" ]; do sleep 0.01; done
+echo "fast failure" >&2
+exit 2
+`
+
+func TestRunGoBuildsReportsEveryFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake go is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go"), []byte(fakeGo), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_GO_DIR", dir)
+
+	defer func(q bool) { quiet = q }(quiet)
+	quiet = true
+
+	jobs := []goBuildJob{
+		{goarch: "arm64", args: []string{"build"}, env: []string{"FAKE_GO_SLOW=1"}},
+		{goarch: "amd64", args: []string{"build"}},
+	}
+
+	err := runGoBuilds(context.Background(), jobs, len(jobs))
+
+	var errs buildErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("runGoBuilds returned %v, want build errors", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("runGoBuilds reported %d failures, want 2: %v", len(errs), err)
+	}
+	for _, label := range []string{"[arm64]", "[amd64]"} {
+		if !strings.Contains(err.Error(), label) {
+			t.Errorf("failure of %s is missing from %v", label, err)
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// frames of native backtraces in tombstones and logcat, e.g.
+	// "#00 pc 000000000009a8c4  /data/app/.../lib/arm64/libmain.so (runtime.raise.abi0+20)"
+	nativeFrameRe = regexp.MustCompile(`#\d+\s+pc\s+([0-9a-fA-F]+)\s+(\S*/)?(lib[^/\s]+\.so)`)
+
+	// file and line of a Go traceback frame, e.g. "\t/src/main.go:12 +0x1c"
+	goFrameRe = regexp.MustCompile(`(\S+):\d+ \+0x([0-9a-fA-F]+)`)
+
+	// header of a goroutine in Go tracebacks, e.g. "goroutine 1 [running]:"
+	goroutineRe = regexp.MustCompile(`goroutine \d+ \[`)
+
+	// abi of the crashed process in tombstones, e.g. "ABI: 'arm64'"
+	tombstoneABIRe = regexp.MustCompile(`ABI: '([^']+)'`)
+
+	// abi directory of the library in native frames, e.g. "/lib/arm64/libmain.so",
+	// or "base.apk!lib/arm64-v8a/libmain.so" for libraries loaded from the apk
+	libABIRe = regexp.MustCompile(`[/!]lib/([^/\s]+)/lib[^/\s]+\.so`)
+)
+
+// abi names used by tombstones and installed apps, mapped to android ABI names
+var tombstoneABIs = map[string]string{
+	"arm":    "armeabi-v7a",
+	"arm64":  "arm64-v8a",
+	"x86":    "x86",
+	"x86_64": "x86_64",
+}
+
+type location struct {
+	function string
+	file     string
+	line     int
+}
+
+// symbolsFile is an unstripped shared library from symbolsDir
+type symbolsFile struct {
+	dwarf *dwarf.Data
+	// function symbols sorted by address
+	funcs []elf.Symbol
+}
+
+func openSymbolsFile(name string) (*symbolsFile, error) {
+	f, err := elf.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("openSymbolsFile: %w", err)
+	}
+	defer f.Close()
+
+	s := &symbolsFile{}
+
+	// libraries built without debug info are still symbolized to functions
+	s.dwarf, _ = f.DWARF()
+
+	syms, err := f.Symbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return nil, fmt.Errorf("openSymbolsFile: %w", err)
+	}
+	for _, sym := range syms {
+		if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 {
+			s.funcs = append(s.funcs, sym)
+		}
+	}
+	sort.Slice(s.funcs, func(i, j int) bool { return s.funcs[i].Value < s.funcs[j].Value })
+
+	return s, nil
+}
+
+// entry returns the address of function name
+func (s *symbolsFile) entry(name string) (uint64, bool) {
+	for _, sym := range s.funcs {
+		if sym.Name == name {
+			return sym.Value, true
+		}
+	}
+	return 0, false
+}
+
+// function returns the name of the function symbol containing pc
+func (s *symbolsFile) function(pc uint64) string {
+	i := sort.Search(len(s.funcs), func(i int) bool { return s.funcs[i].Value > pc }) - 1
+	if i < 0 {
+		return ""
+	}
+
+	sym := s.funcs[i]
+	if sym.Size != 0 && pc >= sym.Value+sym.Size {
+		return ""
+	}
+	return sym.Name
+}
+
+// locations returns the source locations of pc, innermost inlined
+// function first and the function containing them last
+func (s *symbolsFile) locations(pc uint64) []location {
+	if s.dwarf == nil {
+		return s.symbolLocation(pc)
+	}
+
+	r := s.dwarf.Reader()
+	cu, err := r.SeekPC(pc)
+	if err != nil {
+		return s.symbolLocation(pc)
+	}
+
+	lr, err := s.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return s.symbolLocation(pc)
+	}
+
+	var le dwarf.LineEntry
+	err = lr.SeekPC(pc, &le)
+	if err != nil {
+		return s.symbolLocation(pc)
+	}
+
+	// walk down the functions, and the functions inlined in them,
+	// that contain pc
+	var chain []*dwarf.Entry
+walk:
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil || e.Tag == 0 {
+			break
+		}
+
+		scope := e.Tag == dwarf.TagSubprogram || e.Tag == dwarf.TagInlinedSubroutine || e.Tag == dwarf.TagLexDwarfBlock
+		if scope && s.containsPC(e, pc) {
+			if e.Tag != dwarf.TagLexDwarfBlock {
+				chain = append(chain, e)
+			}
+			if !e.Children {
+				break walk
+			}
+			// continue with its children
+			continue
+		}
+
+		if e.Children {
+			r.SkipChildren()
+		}
+	}
+
+	if len(chain) == 0 {
+		name := s.function(pc)
+		return []location{{function: name, file: fileName(le.File), line: le.Line}}
+	}
+
+	files := lr.Files()
+	locs := []location{{function: s.entryName(chain[len(chain)-1]), file: fileName(le.File), line: le.Line}}
+	for i := len(chain) - 1; i > 0; i-- {
+		loc := location{function: s.entryName(chain[i-1])}
+		if idx, ok := chain[i].Val(dwarf.AttrCallFile).(int64); ok && idx >= 0 && int(idx) < len(files) {
+			loc.file = fileName(files[idx])
+		}
+		if line, ok := chain[i].Val(dwarf.AttrCallLine).(int64); ok {
+			loc.line = int(line)
+		}
+		locs = append(locs, loc)
+	}
+
+	return locs
+}
+
+func (s *symbolsFile) symbolLocation(pc uint64) []location {
+	name := s.function(pc)
+	if name == "" {
+		return nil
+	}
+	return []location{{function: name}}
+}
+
+func (s *symbolsFile) containsPC(e *dwarf.Entry, pc uint64) bool {
+	ranges, err := s.dwarf.Ranges(e)
+	if err != nil {
+		return false
+	}
+	for _, r := range ranges {
+		if r[0] <= pc && pc < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// entryName returns the name of a function entry, inlined functions
+// and out of line copies take it from their abstract origin
+func (s *symbolsFile) entryName(e *dwarf.Entry) string {
+	for i := 0; i < 4; i++ {
+		if name, ok := e.Val(dwarf.AttrName).(string); ok {
+			return name
+		}
+
+		off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			off, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset)
+		}
+		if !ok {
+			return "??"
+		}
+
+		r := s.dwarf.Reader()
+		r.Seek(off)
+		next, err := r.Next()
+		if err != nil || next == nil {
+			return "??"
+		}
+		e = next
+	}
+	return "??"
+}
+
+func fileName(f *dwarf.LineFile) string {
+	if f == nil {
+		return "??"
+	}
+	return f.Name
+}
+
+// symbolizer maps frames of crash reports to source locations using
+// the unstripped libraries in dir, "<abi>/lib<name>.so"
+type symbolizer struct {
+	dir string
+	abi string
+	// Go tracebacks don't name the library, they are looked up in this one
+	goLib string
+	// next Go traceback frame is the innermost one of its goroutine
+	goTop bool
+
+	files map[string]*symbolsFile
+}
+
+func (s *symbolizer) file(lib string) *symbolsFile {
+	name := filepath.Join(s.dir, s.abi, lib)
+	if f, ok := s.files[name]; ok {
+		return f
+	}
+
+	f, err := openSymbolsFile(name)
+	if err != nil {
+		// frames of system libraries have no symbols here
+		if !errors.Is(err, os.ErrNotExist) {
+			warn("%v", err)
+		}
+		f = nil
+	}
+	s.files[name] = f
+	return f
+}
+
+// detectABI picks the abi directory of dir for the crash report in text
+func detectABI(dir, text string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", &cliError{
+			hint: "build with -release to keep unstripped libraries in " + symbolsDir + ", or pass their directory with -symbols",
+			err:  fmt.Errorf("detectABI: %w", err),
+		}
+	}
+
+	var abis []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			abis = append(abis, entry.Name())
+		}
+	}
+
+	for _, re := range []*regexp.Regexp{tombstoneABIRe, libABIRe} {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		abi := m[1]
+		if name, ok := tombstoneABIs[abi]; ok {
+			abi = name
+		}
+		if contains(abis, abi) {
+			return abi, nil
+		}
+	}
+
+	if len(abis) == 1 {
+		return abis[0], nil
+	}
+
+	return "", usageError("unable to detect the abi of the crash from %s, pass one of %s with -abi", dir, strings.Join(abis, ", "))
+}
+
+// symbolize copies crash report from r to w, following every frame
+// with the source locations it maps to
+func symbolize(r io.Reader, w io.Writer, dir, abi, lib string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("symbolize: %w", err)
+	}
+	text := string(data)
+
+	if abi == "" {
+		abi, err = detectABI(dir, text)
+		if err != nil {
+			return err
+		}
+	}
+
+	s := &symbolizer{
+		dir:   dir,
+		abi:   abi,
+		goLib: "lib" + lib + ".so",
+		files: map[string]*symbolsFile{},
+	}
+
+	bw := bufio.NewWriter(w)
+
+	var prev string
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		_, _ = io.WriteString(bw, line)
+		if !strings.HasSuffix(line, "\n") {
+			_, _ = io.WriteString(bw, "\n")
+		}
+
+		indent, locs := s.symbolizeLine(prev, strings.TrimRight(line, "\r\n"))
+		for _, loc := range locs {
+			fmt.Fprintf(bw, "%s    %s\n", indent, loc.function)
+			if loc.file != "" {
+				fmt.Fprintf(bw, "%s        %s:%d\n", indent, loc.file, loc.line)
+			}
+		}
+
+		if strings.TrimSpace(line) != "" {
+			prev = strings.TrimRight(line, "\r\n")
+		}
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return fmt.Errorf("symbolize: %w", err)
+	}
+	return nil
+}
+
+// symbolizeLine returns source locations of the frame in line, prev is
+// the previous line which holds the function of Go traceback frames
+func (s *symbolizer) symbolizeLine(prev, line string) (string, []location) {
+	if m := nativeFrameRe.FindStringSubmatchIndex(line); m != nil {
+		pc, err := strconv.ParseUint(line[m[2]:m[3]], 16, 64)
+		if err != nil {
+			return "", nil
+		}
+
+		f := s.file(line[m[6]:m[7]])
+		if f == nil {
+			return "", nil
+		}
+		return indentOf(line[:m[0]]), f.locations(pc)
+	}
+
+	if goroutineRe.MatchString(line) {
+		s.goTop = true
+		return "", nil
+	}
+
+	if m := goFrameRe.FindStringSubmatchIndex(line); m != nil {
+		top := s.goTop
+		s.goTop = false
+
+		off, err := strconv.ParseUint(line[m[4]:m[5]], 16, 64)
+		if err != nil {
+			return "", nil
+		}
+
+		name := goFuncName(prev)
+		if name == "" {
+			return "", nil
+		}
+
+		f := s.file(s.goLib)
+		if f == nil {
+			return "", nil
+		}
+
+		entry, ok := f.entry(name)
+		if !ok {
+			return "", nil
+		}
+
+		// offsets of caller frames point after the call instruction
+		pc := entry + off
+		if !top && off > 0 {
+			pc--
+		}
+		return indentOf(line[:m[0]]), f.locations(pc)
+	}
+
+	return "", nil
+}
+
+// goFuncName returns the function of a Go traceback frame from the line
+// preceding its file and line, e.g. "main.(*T).m(0x1, ...)" or
+// "created by main.main in goroutine 1"
+func goFuncName(line string) string {
+	if i := strings.Index(line, "created by "); i >= 0 {
+		fields := strings.Fields(line[i+len("created by "):])
+		if len(fields) == 0 {
+			return ""
+		}
+		return fields[0]
+	}
+
+	line = strings.TrimRight(line, " \t")
+	if !strings.HasSuffix(line, ")") {
+		return ""
+	}
+
+	// strip the arguments, the last balanced parentheses
+	depth := 0
+	for i := len(line) - 1; i >= 0; i-- {
+		switch line[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+			if depth == 0 {
+				fields := strings.Fields(line[:i])
+				if len(fields) == 0 {
+					return ""
+				}
+				return fields[len(fields)-1]
+			}
+		}
+	}
+	return ""
+}
+
+// indentOf turns the text before a frame into indentation, so
+// source locations line up with the frame
+func indentOf(prefix string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, prefix)
+}
+
+// symbolizeFile symbolizes the crash report in name, or stdin if
+// name is empty or "-"
+func symbolizeFile(name string) error {
+	r := io.Reader(os.Stdin)
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return usageError("%w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return symbolize(r, os.Stdout, symbols, crashABI, libName)
+}
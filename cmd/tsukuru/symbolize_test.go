@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectABI(t *testing.T) {
+	dir := t.TempDir()
+	for _, abi := range []string{"arm64-v8a", "armeabi-v7a", "x86_64"} {
+		if err := os.Mkdir(filepath.Join(dir, abi), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"tombstone", "ABI: 'arm'\n", "armeabi-v7a"},
+		{"installed", "#00 pc 000000000009a8c4  /data/app/~~x==/com.example-y==/lib/arm64/libmain.so (runtime.raise.abi0+20)", "arm64-v8a"},
+		{"apk", "#00 pc 000000000009a8c4  /data/app/~~x==/com.example-y==/base.apk!lib/x86_64/libmain.so (offset 0x4000)", "x86_64"},
+		{"apk android abi", "#00 pc 000000000009a8c4  /data/app/com.example-1/base.apk!lib/arm64-v8a/libmain.so (offset 0x4000)", "arm64-v8a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectABI(dir, tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("detectABI(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
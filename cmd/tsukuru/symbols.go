@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// unstripped shared libraries of release builds are kept here,
+// in "<abi>/lib<name>.so"
+var symbolsDir = filepath.Join("target", "symbols")
+
+type stripJob struct {
+	abi    string
+	strip  string
+	input  string
+	output string
+}
+
+// stripLibraries writes stripped copies of unstripped libraries,
+// and archives the unstripped ones in native-debug-symbols.zip
+func stripLibraries(ctx context.Context, jobs []stripJob) error {
+	for _, job := range jobs {
+		err := os.MkdirAll(filepath.Dir(job.output), 0755)
+		if err != nil {
+			return fmt.Errorf("stripLibraries: %w", err)
+		}
+
+		cmd := exec.CommandContext(ctx, job.strip, "--strip-all", "-o", job.output, job.input)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		done := startStep("strip " + job.abi)
+		err = runCmd("strip "+job.abi, cmd)
+		done(err)
+		if err != nil {
+			return fmt.Errorf("stripLibraries: %w", err)
+		}
+	}
+
+	symbolsZip := filepath.Join("target", "native-debug-symbols.zip")
+	err := writeSymbolsZip(symbolsZip, jobs)
+	if err != nil {
+		return err
+	}
+
+	info("Native debug symbols available at: %s", symbolsZip)
+	return emitArtifact(symbolsZip, "native-debug-symbols")
+}
+
+// writeSymbolsZip archives unstripped libraries in the layout expected
+// by Play Console, "<abi>/lib<name>.so"
+func writeSymbolsZip(name string, jobs []stripJob) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("writeSymbolsZip: %w", err)
+	}
+	defer func() {
+		cerr := f.Close()
+		if err == nil && cerr != nil {
+			err = fmt.Errorf("writeSymbolsZip: %w", cerr)
+		}
+		if err != nil {
+			_ = os.Remove(name)
+		}
+	}()
+
+	w := zip.NewWriter(f)
+
+	for _, job := range jobs {
+		err := addFileToZip(w, job.input, job.abi+"/"+filepath.Base(job.input))
+		if err != nil {
+			return fmt.Errorf("writeSymbolsZip: %w", err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("writeSymbolsZip: %w", err)
+	}
+	return nil
+}
+
+func addFileToZip(w *zip.Writer, file, name string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	return err
+}
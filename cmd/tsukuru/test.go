@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// directory on the device test binaries are pushed to, every package
+// gets its own directory in it
+const deviceTestDir = "/data/local/tmp/tsukuru-test"
+
+// printed after the test binary exits, older adb versions don't forward
+// the exit status of the command run by "adb shell"
+const exitStatusMarker = "tsukuru-exit-status:"
+
+type testPackage struct {
+	ImportPath string
+	Dir        string
+	hasTests   bool
+}
+
+// testEvent is an event in the format of test2json
+type testEvent struct {
+	Time    time.Time `json:",omitempty"`
+	Action  string
+	Package string `json:",omitempty"`
+	Output  string `json:",omitempty"`
+}
+
+// testAndroid cross-compiles tests of packages matching patterns, runs them
+// on the device for its ABI and prints their output. testArgs are passed to
+// every test binary.
+func testAndroid(ctx context.Context, patterns, testArgs []string) error {
+	// -json writes only test2json events to stdout,
+	// every other output goes to stderr
+	var jsonOut io.Writer
+	if jsonOutput {
+		jsonOut, eventsOut = eventsOut, nil
+		testArgs = append([]string{"-test.v"}, testArgs...)
+	}
+
+	adb := adbPath
+	if adb == "" {
+		var err error
+		adb, err = findAdb()
+		if err != nil {
+			return err
+		}
+	}
+
+	abi, err := deviceABI(ctx, adb)
+	if err != nil {
+		return err
+	}
+
+	apiLevel := minSdk
+	if androidDir != "" {
+		apiLevel, _, err = androidbuilder.FindMinSdkAndTargetSdk(androidDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	androidSdkRoot, _, err := androidbuilder.GetAndroidSdkRoot()
+	if err != nil {
+		return err
+	}
+
+	ndkDir, err := androidbuilder.ResolveNdk(ctx, androidSdkRoot, androidDir, ndkOptions()...)
+	if err != nil {
+		return err
+	}
+
+	toolchain, err := androidbuilder.NewNDKToolchain(ndkDir, abi, apiLevel)
+	if err != nil {
+		return err
+	}
+
+	env := androidGoEnv(abi, toolchain)
+
+	pkgs, err := listTestPackages(patterns, env)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, pkg := range pkgs {
+		if !pkg.hasTests {
+			if jsonOut != nil {
+				writeTestEvents(jsonOut,
+					testEvent{Time: time.Now(), Action: "output", Package: pkg.ImportPath, Output: "?   \t" + pkg.ImportPath + "\t[no test files]\n"},
+					testEvent{Time: time.Now(), Action: "skip", Package: pkg.ImportPath},
+				)
+				continue
+			}
+			fmt.Printf("?   \t%s\t[no test files]\n", pkg.ImportPath)
+			continue
+		}
+
+		start := time.Now()
+		ok, err := runAndroidTest(ctx, adb, abi, env, pkg, testArgs, jsonOut)
+		if err != nil {
+			return err
+		}
+
+		if jsonOut == nil {
+			status := "ok  "
+			if !ok {
+				status = "FAIL"
+			}
+			fmt.Printf("%s\t%s\t%.3fs\n", status, pkg.ImportPath, time.Since(start).Seconds())
+		}
+
+		if !ok {
+			failed = append(failed, pkg.ImportPath)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("testAndroid: tests failed in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// deviceABI returns the ABI of the connected device
+func deviceABI(ctx context.Context, adb string) (androidbuilder.ABI, error) {
+	cmd := exec.CommandContext(ctx, adb, "shell", "getprop", "ro.product.cpu.abi")
+	cmd.Stderr = os.Stderr
+	out, err := outputCmd("getprop", cmd)
+	if err != nil {
+		return androidbuilder.ABI{}, deviceError(fmt.Errorf("adb shell getprop: %w", err))
+	}
+	name := strings.TrimSpace(string(out))
+
+	abis, err := configuredABIs(abiFlags)
+	if err != nil {
+		return androidbuilder.ABI{}, err
+	}
+
+	for _, abi := range abis {
+		if abi.Name == name {
+			return abi, nil
+		}
+	}
+
+	return androidbuilder.ABI{}, deviceError(fmt.Errorf("deviceABI: no GOARCH builds for ABI %q of the device, add one with -abi", name))
+}
+
+// listTestPackages lists packages matching patterns, for the android
+// environment env
+func listTestPackages(patterns, env []string) ([]testPackage, error) {
+	args := []string{"list", "-f", "{{ .ImportPath }}\t{{ .Dir }}\t{{ len .TestGoFiles }}\t{{ len .XTestGoFiles }}"}
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	args = append(args, patterns...)
+
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = os.Stderr
+	out, err := outputCmd("go list", cmd)
+	if err != nil {
+		return nil, compileError(fmt.Errorf("listTestPackages: %w", err))
+	}
+
+	var pkgs []testPackage
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		pkgs = append(pkgs, testPackage{
+			ImportPath: fields[0],
+			Dir:        fields[1],
+			hasTests:   fields[2] != "0" || fields[3] != "0",
+		})
+	}
+
+	return pkgs, nil
+}
+
+// runAndroidTest compiles the test binary of pkg, runs it on the device and
+// prints its output, or test2json events of it if jsonOut is set. Reports
+// whether the tests passed.
+func runAndroidTest(ctx context.Context, adb string, abi androidbuilder.ABI, env []string, pkg testPackage, testArgs []string, jsonOut io.Writer) (bool, error) {
+	name := path.Base(pkg.ImportPath) + ".test"
+	bin := filepath.Join("target", "test", abi.Name, filepath.FromSlash(pkg.ImportPath), name)
+	deviceDir := deviceTestDir + "/" + pkg.ImportPath
+
+	{
+		args := []string{"test", "-c", "-o", bin}
+		flags, _ := androidGoFlags(abi)
+		args = append(args, flags...)
+		args = append(args, pkg.ImportPath)
+
+		cmd := exec.Command("go", args...)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+
+		step := "go test -c GOOS=android GOARCH=" + abi.GOARCH + " " + pkg.ImportPath
+		done := startStep(step)
+		err := runCmdContext(ctx, step, cmd)
+		done(err)
+		if err != nil {
+			return false, compileError(fmt.Errorf("go test -c for %s: %w", pkg.ImportPath, err))
+		}
+	}
+
+	err := adbRun(ctx, adb, "shell", "rm -rf "+shellQuote(deviceDir)+" && mkdir -p "+shellQuote(deviceDir))
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = adbRun(context.Background(), adb, "shell", "rm -rf "+shellQuote(deviceDir))
+	}()
+
+	err = adbRun(ctx, adb, "push", bin, deviceDir+"/"+name)
+	if err != nil {
+		return false, err
+	}
+
+	// tests run in the directory of their package, same as go test
+	testdata := filepath.Join(pkg.Dir, "testdata")
+	if info, err := os.Stat(testdata); err == nil && info.IsDir() {
+		err = adbRun(ctx, adb, "push", testdata, deviceDir+"/")
+		if err != nil {
+			return false, err
+		}
+	}
+
+	script := "cd " + shellQuote(deviceDir) + " && chmod 755 " + shellQuote(name) + " && ./" + shellQuote(name)
+	for _, arg := range testArgs {
+		script += " " + shellQuote(arg)
+	}
+	script += "; echo " + exitStatusMarker + "$?"
+
+	var (
+		out       io.Writer = os.Stdout
+		test2json *exec.Cmd
+		in        io.WriteCloser
+	)
+	if jsonOut != nil {
+		test2json = exec.CommandContext(ctx, "go", "tool", "test2json", "-t", "-p", pkg.ImportPath)
+		test2json.Stdout = jsonOut
+		test2json.Stderr = os.Stderr
+		in, err = test2json.StdinPipe()
+		if err != nil {
+			return false, fmt.Errorf("runAndroidTest: %w", err)
+		}
+		err = test2json.Start()
+		if err != nil {
+			return false, fmt.Errorf("runAndroidTest: %w", err)
+		}
+		out = in
+	}
+
+	w := &exitStatusWriter{w: out, status: -1}
+	cmd := exec.CommandContext(ctx, adb, "shell", script)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	err = runCmd("test", cmd)
+	w.Flush()
+
+	if test2json != nil {
+		in.Close()
+		werr := test2json.Wait()
+		if err == nil && werr != nil {
+			return false, fmt.Errorf("go tool test2json: %w", werr)
+		}
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, deviceError(fmt.Errorf("adb shell: %w", err))
+	}
+	if w.status == -1 {
+		return false, deviceError(errors.New("adb shell: exit status of " + name + " is missing from its output"))
+	}
+
+	return w.status == 0, nil
+}
+
+func adbRun(ctx context.Context, adb string, args ...string) error {
+	cmd := exec.CommandContext(ctx, adb, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err := runCmd("adb "+args[0], cmd)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return deviceError(fmt.Errorf("adb %s: %w", args[0], err))
+	}
+	return nil
+}
+
+func writeTestEvents(w io.Writer, events ...testEvent) {
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		_ = enc.Encode(e)
+	}
+}
+
+// shellQuote quotes s for the device shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// exitStatusWriter forwards output of a test binary to w, except for the
+// line holding exitStatusMarker which sets status
+type exitStatusWriter struct {
+	w      io.Writer
+	buf    bytes.Buffer
+	status int
+}
+
+func (e *exitStatusWriter) Write(b []byte) (int, error) {
+	e.buf.Write(b)
+	for {
+		i := bytes.IndexByte(e.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		e.line(string(e.buf.Next(i + 1)))
+	}
+}
+
+// Flush writes the remaining incomplete line
+func (e *exitStatusWriter) Flush() {
+	if e.buf.Len() > 0 {
+		e.line(e.buf.String())
+		e.buf.Reset()
+	}
+}
+
+func (e *exitStatusWriter) line(l string) {
+	// "adb shell" may run the command in a pty
+	l = strings.TrimRight(l, "\r\n")
+
+	if i := strings.Index(l, exitStatusMarker); i >= 0 {
+		status, err := strconv.Atoi(strings.TrimSpace(l[i+len(exitStatusMarker):]))
+		if err == nil {
+			e.status = status
+		}
+		l = l[:i]
+		if l == "" {
+			return
+		}
+	}
+
+	_, _ = io.WriteString(e.w, l+"\n")
+}
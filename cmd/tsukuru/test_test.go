@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// fakeAdb is a stand-in adb running the commands of the "device" on the host,
+// with the device filesystem rooted at $FAKE_ADB_ROOT. Like older adb versions
+// it doesn't forward the exit status of "adb shell".
+const fakeAdb = `#!/bin/sh
+root="$FAKE_ADB_ROOT"
+case "$1" in
+push)
+	mkdir -p "$root$(dirname "$3")" && cp -R "$2" "$root$3"
+	;;
+pull)
+	cp -R "$root$2" "$3"
+	;;
+shell)
+	shift
+	if [ "$*" = "getprop ro.product.cpu.abi" ]; then
+		echo "$FAKE_ADB_ABI"
+		exit 0
+	fi
+	sh -c "$(echo "$*" | sed "s#/data/local/tmp#$root/data/local/tmp#g")"
+	exit 0
+	;;
+*)
+	echo "fake adb: unsupported command $1" >&2
+	exit 1
+	;;
+esac
+`
+
+var fakeModule = map[string]string{
+	"go.mod": "module example.com/fake\n\ngo 1.18\n",
+	"pass/pass_test.go": `package pass
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPass(t *testing.T) {
+	b, err := os.ReadFile("testdata/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(string(b))
+}
+`,
+	"pass/testdata/hello.txt": "hello from testdata",
+	"fail/fail_test.go": `package fail
+
+import "testing"
+
+func TestFail(t *testing.T) {
+	t.Error("failed on purpose")
+}
+`,
+}
+
+func TestAndroidWithFakeAdb(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake adb is a shell script")
+	}
+
+	var abi androidbuilder.ABI
+	for _, a := range androidbuilder.DefaultABIs() {
+		if a.GOARCH == runtime.GOARCH {
+			abi = a
+		}
+	}
+	if abi.Name == "" {
+		t.Skipf("no android abi for GOARCH=%s", runtime.GOARCH)
+	}
+
+	dir := t.TempDir()
+	adb := filepath.Join(dir, "adb")
+	if err := os.WriteFile(adb, []byte(fakeAdb), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_ADB_ROOT", filepath.Join(dir, "device"))
+	t.Setenv("FAKE_ADB_ABI", abi.Name)
+
+	module := filepath.Join(dir, "module")
+	for name, content := range fakeModule {
+		file := filepath.Join(module, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(module); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	defer func(q bool) { quiet = q }(quiet)
+	quiet = true
+
+	ctx := context.Background()
+
+	got, err := deviceABI(ctx, adb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != abi.Name {
+		t.Fatalf("deviceABI = %s, want %s", got.Name, abi.Name)
+	}
+
+	// test binaries run on the host, without the ndk
+	env := append(abi.GoEnv(), "CGO_ENABLED=0")
+
+	tests := []struct {
+		pkg    string
+		ok     bool
+		action string
+		output string
+	}{
+		{"example.com/fake/pass", true, "pass", "hello from testdata"},
+		{"example.com/fake/fail", false, "fail", "failed on purpose"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pkg, func(t *testing.T) {
+			pkg := testPackage{ImportPath: tt.pkg, Dir: filepath.Join(module, filepath.Base(tt.pkg)), hasTests: true}
+
+			var out bytes.Buffer
+			ok, err := runAndroidTest(ctx, adb, abi, env, pkg, []string{"-test.v"}, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok {
+				t.Errorf("runAndroidTest reported ok=%v, want %v", ok, tt.ok)
+			}
+
+			var (
+				action string
+				output strings.Builder
+			)
+			s := bufio.NewScanner(&out)
+			for s.Scan() {
+				var e testEvent
+				if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+					t.Fatalf("invalid test2json event %q: %v", s.Text(), err)
+				}
+				if e.Package != tt.pkg {
+					t.Errorf("event of package %q, want %q", e.Package, tt.pkg)
+				}
+				if e.Output == "" {
+					action = e.Action
+				}
+				output.WriteString(e.Output)
+			}
+
+			if action != tt.action {
+				t.Errorf("last action is %q, want %q", action, tt.action)
+			}
+			if !strings.Contains(output.String(), tt.output) {
+				t.Errorf("output doesn't contain %q:\n%s", tt.output, output.String())
+			}
+			if strings.Contains(output.String(), exitStatusMarker) {
+				t.Errorf("output contains %s:\n%s", exitStatusMarker, output.String())
+			}
+		})
+	}
+}
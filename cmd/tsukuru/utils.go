@@ -14,6 +14,15 @@ func contains[T comparable](s []T, e T) bool {
 	return false
 }
 
+func indexOf[T comparable](s []T, e T) int {
+	for i, v := range s {
+		if v == e {
+			return i
+		}
+	}
+	return -1
+}
+
 func cp(src, dst string) error {
 	srcf, err := os.Open(src)
 	if err != nil {
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rajveermalviya/tsukuru/androidbuilder"
+)
+
+// javaNative is a native method declared in java sources
+type javaNative struct {
+	pos string
+	// binary name of the declaring class, e.g. "com.example.Main$Inner"
+	class  string
+	method string
+}
+
+// symbol returns the short JNI name of the method, overloaded methods
+// may also be bound with the long name which adds "__<signature>"
+func (n javaNative) symbol() string {
+	return androidbuilder.JNIFunctionName(n.class, n.method)
+}
+
+// javaLoad is a System.loadLibrary call in java sources
+type javaLoad struct {
+	pos  string
+	name string
+	// binary name of the class making the call
+	class string
+}
+
+// goExport is a function exported by a go library
+type goExport struct {
+	pos  string
+	name string
+	lib  goLibrary
+}
+
+// vet checks that native methods and System.loadLibrary calls in java
+// sources of the app match the functions exported by the go libraries
+// and their names, exports are read from the go sources of libs
+func vet(libs []goLibrary) error {
+	var exports []goExport
+	for _, lib := range libs {
+		e, err := goSourceExports(lib)
+		if err != nil {
+			return err
+		}
+		exports = append(exports, e...)
+	}
+
+	problems, err := checkBindings(libs, exports)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	if len(problems) > 0 {
+		return bindingError(fmt.Errorf("vet: %d problems found in JNI bindings", len(problems)))
+	}
+	return nil
+}
+
+// checkBuiltBindings is vet for builds, exports are read from the built
+// libraries. Problems are only warned about, native methods may be bound by
+// libraries not visible to tsukuru, e.g. from AARs or other gradle modules.
+func checkBuiltBindings(libs []goLibrary, shipped []shippedLibrary) error {
+	var exports []goExport
+	for _, lib := range libs {
+		// every abi exports the same functions
+		for _, s := range shipped {
+			if filepath.Base(s.path) != lib.file() {
+				continue
+			}
+
+			names, err := androidbuilder.ExportedFunctions(s.path)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				exports = append(exports, goExport{pos: displayPath(s.path), name: name, lib: lib})
+			}
+			break
+		}
+	}
+
+	problems, err := checkBindings(libs, exports)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		warn("%s", p)
+	}
+	return nil
+}
+
+func bindingError(err error) error {
+	return &cliError{
+		kind: kindCompile,
+		hint: "exported go functions have to be named Java_<package>_<class>_<method> with \"_\" escaped as \"_1\", and System.loadLibrary or android.app.lib_name has to name a library from -libname or -libs",
+		err:  err,
+	}
+}
+
+// checkBindings reports native methods without a go export, go exports
+// without a native method, System.loadLibrary calls and native activities
+// loading libraries that are neither built nor in jniLibs, and libraries
+// that are never loaded, as "<file>:<line>: <problem>"
+func checkBindings(libs []goLibrary, exports []goExport) ([]string, error) {
+	natives, loads, err := parseJavaSources(filepath.Join(androidDir, "app", "src"))
+	if err != nil {
+		return nil, err
+	}
+
+	// native methods of classes loading a library that isn't built from go
+	// may be bound by it, e.g. a c library of externalNativeBuild, or one
+	// registering them with RegisterNatives in JNI_OnLoad
+	foreign := map[string]bool{}
+	for _, l := range loads {
+		if !isGoLibrary(libs, l.name) {
+			foreign[outerClass(l.class)] = true
+		}
+	}
+
+	var problems []string
+
+	bound := map[string]bool{}
+	for _, n := range natives {
+		sym := n.symbol()
+
+		var found bool
+		for _, e := range exports {
+			if e.name == sym || strings.HasPrefix(e.name, sym+"__") {
+				bound[e.name] = true
+				found = true
+			}
+		}
+		if found || foreign[outerClass(n.class)] {
+			continue
+		}
+
+		p := fmt.Sprintf("%s: native method %s of %s has no go export %s", n.pos, n.method, n.class, sym)
+
+		// an export for the same method name likely is the one meant
+		// for it, mangled for a renamed package or class
+		for _, e := range exports {
+			if strings.HasPrefix(e.name, "Java_") && !bound[e.name] &&
+				(strings.HasSuffix(e.name, "_"+androidbuilder.JNIMangle(n.method)) || strings.Contains(e.name, "_"+androidbuilder.JNIMangle(n.method)+"__")) {
+				p += fmt.Sprintf(", %s exports %s instead", e.pos, e.name)
+				bound[e.name] = true
+				break
+			}
+		}
+		problems = append(problems, p)
+	}
+
+	for _, e := range exports {
+		if strings.HasPrefix(e.name, "Java_") && !bound[e.name] {
+			problems = append(problems, fmt.Sprintf("%s: %s exported by lib%s.so doesn't match any native method in java or kotlin sources", e.pos, e.name, e.lib.name))
+		}
+	}
+
+	jniLibs, err := jniLibNames()
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := map[string]bool{}
+	for _, l := range loads {
+		loaded[l.name] = true
+
+		if !contains(jniLibs, l.name) && !isGoLibrary(libs, l.name) {
+			problems = append(problems, fmt.Sprintf("%s: System.loadLibrary(%q) loads lib%s.so, which is neither built from go (-libname %q) nor in jniLibs", l.pos, l.name, l.name, libs[0].name))
+		}
+	}
+
+	manifest := filepath.Join(androidDir, "app", "src", "main", "AndroidManifest.xml")
+	activities, err := androidbuilder.GetNativeActivitiesFromManifest(manifest)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, a := range activities {
+		loaded[a.LibName] = true
+
+		if !isGoLibrary(libs, a.LibName) {
+			if !contains(jniLibs, a.LibName) {
+				problems = append(problems, fmt.Sprintf("%s: android.app.lib_name of %s loads lib%s.so, which is neither built from go (-libname %q) nor in jniLibs", displayPath(manifest), a.Name, a.LibName, libs[0].name))
+			}
+			continue
+		}
+
+		var found bool
+		for _, e := range exports {
+			if e.lib.name == a.LibName && e.name == a.FuncName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p := fmt.Sprintf("%s: %s calls %s of lib%s.so, which doesn't export it", displayPath(manifest), a.Name, a.FuncName, a.LibName)
+			if a.FuncName == "ANativeActivity_onCreate" {
+				p += ", import github.com/rajveermalviya/tsukuru/nativeactivity"
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	for _, lib := range libs {
+		if loaded[lib.name] {
+			continue
+		}
+		// libraries without JNI bindings may be loaded by other means,
+		// e.g. NativeActivity
+		for _, e := range exports {
+			if e.lib.name == lib.name && strings.HasPrefix(e.name, "Java_") {
+				problems = append(problems, fmt.Sprintf("%s: lib%s.so exports JNI bindings but no System.loadLibrary(%q) loads it", displayPath(lib.pkg), lib.name, lib.name))
+				break
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// outerClass returns the top level class of the binary class name,
+// e.g. "com.example.Main" for "com.example.Main$Inner"
+func outerClass(class string) string {
+	outer, _, _ := strings.Cut(class, "$")
+	return outer
+}
+
+func isGoLibrary(libs []goLibrary, name string) bool {
+	for _, lib := range libs {
+		if lib.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// jniLibNames returns names of the libraries in jniLibs of every abi,
+// without the "lib" prefix and ".so" suffix as passed to loadLibrary
+func jniLibNames() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(androidDir, "app", "src", "main", "jniLibs", "*", "lib*.so"))
+	if err != nil {
+		return nil, fmt.Errorf("jniLibNames: %w", err)
+	}
+
+	var names []string
+	for _, m := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), "lib"), ".so")
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// goSourceExports returns the functions marked with //export in cgo files
+// of lib and its dependencies
+func goSourceExports(lib goLibrary) ([]goExport, error) {
+	// exports don't depend on the GOARCH
+	dirs, err := goDepDirs([]string{lib.pkg}, "GOOS=android", "GOARCH=arm64", "CGO_ENABLED=1")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := build.Default
+	ctx.GOOS = "android"
+	ctx.GOARCH = "arm64"
+	ctx.CgoEnabled = true
+	ctx.BuildTags = strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' })
+
+	var exports []goExport
+	for _, dir := range dirs {
+		pkg, err := ctx.ImportDir(dir, 0)
+		if err != nil {
+			var noGo *build.NoGoError
+			if errors.As(err, &noGo) {
+				continue
+			}
+			return nil, compileError(fmt.Errorf("goSourceExports: %w", err))
+		}
+
+		for _, name := range pkg.CgoFiles {
+			file := filepath.Join(dir, name)
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, fmt.Errorf("goSourceExports: %w", err)
+			}
+
+			s := bufio.NewScanner(f)
+			for line := 1; s.Scan(); line++ {
+				fields := strings.Fields(s.Text())
+				if len(fields) >= 2 && fields[0] == "//export" {
+					exports = append(exports, goExport{
+						pos:  displayPath(file) + ":" + strconv.Itoa(line),
+						name: fields[1],
+						lib:  lib,
+					})
+				}
+			}
+			err = s.Err()
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("goSourceExports: %w", err)
+			}
+		}
+	}
+
+	return exports, nil
+}
+
+// parseJavaSources collects native methods and System.loadLibrary calls
+// of every java and kotlin file in dir
+func parseJavaSources(dir string) ([]javaNative, []javaLoad, error) {
+	var (
+		natives []javaNative
+		loads   []javaLoad
+	)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		parse := parseJava
+		switch {
+		case d.IsDir():
+			return nil
+		case strings.HasSuffix(path, ".kt"):
+			parse = parseKotlin
+		case !strings.HasSuffix(path, ".java"):
+			return nil
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		n, l := parse(displayPath(path), string(src))
+		natives = append(natives, n...)
+		loads = append(loads, l...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("parseJavaSources: %w", err)
+	}
+
+	sort.SliceStable(natives, func(i, j int) bool { return natives[i].pos < natives[j].pos })
+	return natives, loads, nil
+}
+
+type javaToken struct {
+	text string
+	// string literal, text holds its contents
+	str  bool
+	line int
+}
+
+// parseJava finds native methods and System.loadLibrary calls in the
+// java source src of file. It only tracks package and class declarations,
+// which is all JNI names depend on.
+func parseJava(file string, src string) ([]javaNative, []javaLoad) {
+	toks := tokenizeJava(src)
+	is := func(i int, text string) bool {
+		return i >= 0 && i < len(toks) && !toks[i].str && toks[i].text == text
+	}
+	pos := func(t javaToken) string {
+		return file + ":" + strconv.Itoa(t.line)
+	}
+
+	var (
+		natives []javaNative
+		loads   []javaLoad
+
+		pkg string
+		// class declared by every open brace, "" for other blocks
+		classes []string
+		pending string
+	)
+
+	className := func() string {
+		var names []string
+		for _, c := range classes {
+			if c != "" {
+				names = append(names, c)
+			}
+		}
+		class := strings.Join(names, "$")
+		if pkg != "" {
+			class = pkg + "." + class
+		}
+		return class
+	}
+
+	for i, t := range toks {
+		if t.str {
+			continue
+		}
+
+		switch t.text {
+		case "package":
+			if len(classes) == 0 {
+				var b strings.Builder
+				for j := i + 1; j < len(toks) && !is(j, ";"); j++ {
+					b.WriteString(toks[j].text)
+				}
+				pkg = b.String()
+			}
+
+		case "class", "interface", "enum", "record":
+			// skip class literals like "Main.class"
+			if !is(i-1, ".") && i+1 < len(toks) && isJavaIdent(toks[i+1]) {
+				pending = toks[i+1].text
+			}
+
+		case "{":
+			classes = append(classes, pending)
+			pending = ""
+
+		case "}":
+			if len(classes) > 0 {
+				classes = classes[:len(classes)-1]
+			}
+
+		case "native":
+			j := i + 1
+			for j < len(toks) && !is(j, "(") && !is(j, ";") && !is(j, "{") {
+				j++
+			}
+			if !is(j, "(") || !isJavaIdent(toks[j-1]) {
+				continue
+			}
+
+			natives = append(natives, javaNative{
+				pos:    pos(toks[j-1]),
+				class:  className(),
+				method: toks[j-1].text,
+			})
+
+		case "loadLibrary":
+			if is(i-1, ".") && is(i-2, "System") && is(i+1, "(") && i+3 < len(toks) && toks[i+2].str && is(i+3, ")") {
+				loads = append(loads, javaLoad{pos: pos(t), name: toks[i+2].text, class: className()})
+			}
+		}
+	}
+
+	return natives, loads
+}
+
+// parseKotlin is parseJava for the kotlin source src of file, native methods
+// are external functions. Functions outside of classes belong to the class
+// of the file, e.g. "MainKt" for Main.kt, or the one named by @file:JvmName.
+func parseKotlin(file string, src string) ([]javaNative, []javaLoad) {
+	toks := tokenizeJava(src)
+	is := func(i int, text string) bool {
+		return i >= 0 && i < len(toks) && !toks[i].str && toks[i].text == text
+	}
+	pos := func(t javaToken) string {
+		return file + ":" + strconv.Itoa(t.line)
+	}
+
+	var (
+		natives []javaNative
+		loads   []javaLoad
+
+		pkg       string
+		fileClass = kotlinFileClass(file)
+		// class declared by every open brace, "" for other blocks
+		classes []string
+		pending string
+		parens  int
+	)
+
+	// jvmStatic reports if the function is a static method of the class
+	// around its companion object
+	className := func(jvmStatic bool) string {
+		var names []string
+		for _, c := range classes {
+			if c != "" {
+				names = append(names, c)
+			}
+		}
+		if jvmStatic && len(names) > 1 && names[len(names)-1] == "Companion" {
+			names = names[:len(names)-1]
+		}
+
+		class := fileClass
+		if len(names) > 0 {
+			class = strings.Join(names, "$")
+		}
+		if pkg != "" {
+			class = pkg + "." + class
+		}
+		return class
+	}
+
+	for i, t := range toks {
+		if t.str {
+			continue
+		}
+
+		switch t.text {
+		case "package":
+			if len(classes) == 0 && pkg == "" {
+				// the declaration ends with its line
+				var b strings.Builder
+				for j := i + 1; j < len(toks) && toks[j].line == t.line && !is(j, ";"); j++ {
+					b.WriteString(toks[j].text)
+				}
+				pkg = b.String()
+			}
+
+		case "JvmName":
+			// @file:JvmName("Name")
+			if is(i-1, ":") && is(i-2, "file") && is(i+1, "(") && i+2 < len(toks) && toks[i+2].str {
+				fileClass = toks[i+2].text
+			}
+
+		case "class", "interface":
+			// skip class references like "Main::class"
+			if !is(i-1, ":") && !is(i-1, ".") && i+1 < len(toks) && isJavaIdent(toks[i+1]) {
+				pending = toks[i+1].text
+			}
+
+		case "object":
+			switch {
+			case i+1 < len(toks) && isJavaIdent(toks[i+1]):
+				pending = toks[i+1].text
+			case is(i-1, "companion"):
+				pending = "Companion"
+			default:
+				// object expression
+				pending = ""
+			}
+
+		case "fun", "val", "var":
+			// classes without a body
+			if parens == 0 {
+				pending = ""
+			}
+
+		case "(":
+			parens++
+
+		case ")":
+			if parens > 0 {
+				parens--
+			}
+
+		case "{":
+			classes = append(classes, pending)
+			pending = ""
+
+		case "}":
+			if len(classes) > 0 {
+				classes = classes[:len(classes)-1]
+			}
+
+		case "external":
+			// modifiers may follow, e.g. "external override fun"
+			j := i + 1
+			for j < len(toks) && isJavaIdent(toks[j]) && toks[j].text != "fun" {
+				j++
+			}
+			if !is(j, "fun") || j+1 >= len(toks) || !isJavaIdent(toks[j+1]) || !is(j+2, "(") {
+				continue
+			}
+
+			// annotations and modifiers before "external"
+			var jvmStatic bool
+			for k := i - 1; k >= 0 && (isJavaIdent(toks[k]) || is(k, "@")); k-- {
+				if toks[k].text == "JvmStatic" && is(k-1, "@") {
+					jvmStatic = true
+				}
+			}
+
+			natives = append(natives, javaNative{
+				pos:    pos(toks[j+1]),
+				class:  className(jvmStatic),
+				method: toks[j+1].text,
+			})
+
+		case "loadLibrary":
+			if is(i-1, ".") && is(i-2, "System") && is(i+1, "(") && i+3 < len(toks) && toks[i+2].str && is(i+3, ")") {
+				loads = append(loads, javaLoad{pos: pos(t), name: toks[i+2].text, class: className(false)})
+			}
+		}
+	}
+
+	return natives, loads
+}
+
+// kotlinFileClass returns the class of functions declared outside of
+// classes in the kotlin file, e.g. "MainKt" for Main.kt
+func kotlinFileClass(file string) string {
+	name := []rune(strings.TrimSuffix(filepath.Base(file), ".kt"))
+	for i, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			name[i] = '_'
+		}
+	}
+	if len(name) > 0 {
+		name[0] = unicode.ToUpper(name[0])
+	}
+	return string(name) + "Kt"
+}
+
+func isJavaIdent(t javaToken) bool {
+	if t.str || t.text == "" {
+		return false
+	}
+	r := []rune(t.text)[0]
+	return unicode.IsLetter(r) || r == '_' || r == '$'
+}
+
+// tokenizeJava splits src into identifiers, string literals and single
+// character punctuation, skipping comments, char literals and numbers
+func tokenizeJava(src string) []javaToken {
+	var toks []javaToken
+	line := 1
+	r := []rune(src)
+
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '/' && i+1 < len(r) && r[i+1] == '/':
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			i += 2
+			for i < len(r) && !(r[i] == '*' && i+1 < len(r) && r[i+1] == '/') {
+				if r[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			i += 2
+
+		case c == '"' && i+2 < len(r) && r[i+1] == '"' && r[i+2] == '"':
+			// text block
+			start := line
+			i += 3
+			j := i
+			for j < len(r) && !(r[j] == '"' && j+2 < len(r) && r[j+1] == '"' && r[j+2] == '"' && r[j-1] != '\\') {
+				if r[j] == '\n' {
+					line++
+				}
+				j++
+			}
+			toks = append(toks, javaToken{text: string(r[i:j]), str: true, line: start})
+			i = j + 3
+
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(r) && r[j] != c && r[j] != '\n' {
+				if r[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j > len(r) {
+				j = len(r)
+			}
+			if c == '"' {
+				toks = append(toks, javaToken{text: string(r[i+1 : j]), str: true, line: line})
+			}
+			i = j + 1
+
+		case unicode.IsLetter(c) || c == '_' || c == '$':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_' || r[j] == '$') {
+				j++
+			}
+			toks = append(toks, javaToken{text: string(r[i:j]), line: line})
+			i = j
+
+		case unicode.IsDigit(c):
+			for i < len(r) && (unicode.IsLetter(r[i]) || unicode.IsDigit(r[i]) || r[i] == '_' || r[i] == '.') {
+				i++
+			}
+
+		default:
+			toks = append(toks, javaToken{text: string(c), line: line})
+			i++
+		}
+	}
+
+	return toks
+}
+
+// displayPath returns path relative to the working directory if it's
+// inside of it
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJava(t *testing.T) {
+	src := `package com.example.app;
+
+import android.app.Activity;
+
+// native void inLineComment();
+/* native void inBlockComment();
+   System.loadLibrary("commented"); */
+public class Main extends Activity {
+    static {
+        System.loadLibrary("main");
+    }
+
+    private static final String S = "native void inString();";
+    private static final char C = '"';
+    private static final String BLOCK = """
+        native void inTextBlock();
+        """;
+
+    native String greet(String name);
+
+    static class Inner {
+        private static native int add(int a, int b);
+
+        interface Deeper {
+            native void deep();
+        }
+    }
+
+    void load(String name) {
+        Object o = Main.class;
+        System.loadLibrary(name);
+        System.loadLibrary("lib" + name);
+    }
+
+    public native void afterInner();
+}
+
+enum Mode {
+    ON;
+
+    native void set();
+}
+`
+
+	natives, loads := parseJava("Main.java", src)
+
+	wantNatives := []javaNative{
+		{pos: "Main.java:19", class: "com.example.app.Main", method: "greet"},
+		{pos: "Main.java:22", class: "com.example.app.Main$Inner", method: "add"},
+		{pos: "Main.java:25", class: "com.example.app.Main$Inner$Deeper", method: "deep"},
+		{pos: "Main.java:35", class: "com.example.app.Main", method: "afterInner"},
+		{pos: "Main.java:41", class: "com.example.app.Mode", method: "set"},
+	}
+	if !reflect.DeepEqual(natives, wantNatives) {
+		t.Errorf("natives =\n%+v\nwant\n%+v", natives, wantNatives)
+	}
+
+	wantLoads := []javaLoad{
+		{pos: "Main.java:10", name: "main", class: "com.example.app.Main"},
+	}
+	if !reflect.DeepEqual(loads, wantLoads) {
+		t.Errorf("loads =\n%+v\nwant\n%+v", loads, wantLoads)
+	}
+
+	if got, want := natives[1].symbol(), "Java_com_example_app_Main_00024Inner_add"; got != want {
+		t.Errorf("symbol of %s = %s, want %s", natives[1].method, got, want)
+	}
+}
+
+func TestParseKotlin(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		src     string
+		natives []javaNative
+		loads   []javaLoad
+	}{
+		{
+			name: "class and companion object",
+			file: "MainActivity.kt",
+			src: `package com.example.app
+
+class Point(val x: Int, val y: Int)
+
+class MainActivity : Activity() {
+    override fun onCreate(state: Bundle?) {
+        val s = "external fun inString()"
+        println(Point::class.java)
+    }
+
+    // external fun inComment()
+    external fun greet(name: String): String
+
+    companion object {
+        init {
+            System.loadLibrary("main")
+        }
+
+        @JvmStatic external fun staticOne(): Int
+        external fun companionOne()
+    }
+
+    object Holder {
+        private external fun held()
+    }
+}
+`,
+			natives: []javaNative{
+				{pos: "MainActivity.kt:12", class: "com.example.app.MainActivity", method: "greet"},
+				{pos: "MainActivity.kt:19", class: "com.example.app.MainActivity", method: "staticOne"},
+				{pos: "MainActivity.kt:20", class: "com.example.app.MainActivity$Companion", method: "companionOne"},
+				{pos: "MainActivity.kt:24", class: "com.example.app.MainActivity$Holder", method: "held"},
+			},
+			loads: []javaLoad{
+				{pos: "MainActivity.kt:16", name: "main", class: "com.example.app.MainActivity$Companion"},
+			},
+		},
+		{
+			name: "top level functions",
+			file: "native-lib.kt",
+			src: `package com.example.app
+
+external fun topLevel(): Int
+
+fun load(name: String) {
+    System.loadLibrary(name)
+}
+`,
+			natives: []javaNative{
+				{pos: "native-lib.kt:3", class: "com.example.app.Native_libKt", method: "topLevel"},
+			},
+		},
+		{
+			name: "file class name",
+			file: "Natives.kt",
+			src: `@file:JvmName("Bindings")
+package com.example.app
+
+external fun bound()
+`,
+			natives: []javaNative{
+				{pos: "Natives.kt:4", class: "com.example.app.Bindings", method: "bound"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			natives, loads := parseKotlin(tt.file, tt.src)
+			if !reflect.DeepEqual(natives, tt.natives) {
+				t.Errorf("natives =\n%+v\nwant\n%+v", natives, tt.natives)
+			}
+			if !reflect.DeepEqual(loads, tt.loads) {
+				t.Errorf("loads =\n%+v\nwant\n%+v", loads, tt.loads)
+			}
+		})
+	}
+}
+
+func TestTokenizeJava(t *testing.T) {
+	src := "a /* x\ny */ \"s\\\"t\" 'c' '\"' 12.5f\n\"\"\"\nblock\n\"\"\" b_$1;"
+
+	want := []javaToken{
+		{text: "a", line: 1},
+		{text: `s\"t`, str: true, line: 2},
+		{text: "\nblock\n", str: true, line: 3},
+		{text: "b_$1", line: 5},
+		{text: ";", line: 5},
+	}
+	if got := tokenizeJava(src); !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenizeJava =\n%+v\nwant\n%+v", got, want)
+	}
+}
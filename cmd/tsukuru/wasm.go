@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
@@ -9,10 +12,11 @@ import (
 	"strings"
 )
 
-func buildWasm(mainPackagePath string, out string) string {
+func buildWasm(ctx context.Context, mainPackagePath string, out string, stderr io.Writer) (string, error) {
 	wasmPath := filepath.Join("target", "wasm", out)
 	_ = os.RemoveAll(filepath.Dir(wasmPath))
 
+	ldflags := ldflags
 	if release {
 		ldflags += " -s -w"
 	}
@@ -47,47 +51,89 @@ func buildWasm(mainPackagePath string, out string) string {
 		"GOOS=js",
 		"GOARCH=wasm",
 	)
-	fmt.Println(cmd.String())
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = stderr
 	cmd.Stdout = os.Stdout
-	err := cmd.Run()
+	done := startStep("go build GOOS=js GOARCH=wasm")
+	err := runCmdContext(ctx, "go build GOOS=js GOARCH=wasm", cmd)
+	done(err)
 	if err != nil {
-		panic(err)
+		return "", compileError(fmt.Errorf("go build for GOOS=js GOARCH=wasm: %w", err))
 	}
 
 	fmt.Println("Built wasm available at:", wasmPath)
-	return wasmPath
+	return wasmPath, emitArtifact(wasmPath, "wasm")
 }
 
-func runWasm(wasm string) {
+func runWasm(ctx context.Context, wasm string) error {
+	err := copyWasmSupportFiles(filepath.Dir(wasm))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("serving %s at %s\n", filepath.Dir(wasm), addr)
+	return serve(ctx, http.FileServer(http.FS(os.DirFS(filepath.Dir(wasm)))))
+}
+
+// serve serves h at addr until ctx is done
+func serve(ctx context.Context, h http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: h}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return ctx.Err()
+	}
+	return err
+}
+
+// copyWasmSupportFiles copies wasm_exec.js and wasm_exec.html (as index.html)
+// from the go installation to outDir
+func copyWasmSupportFiles(outDir string) error {
 	var goroot string
 	{
-		out, err := exec.Command("go", "env", "GOROOT").Output()
+		out, err := outputCmd("serve", exec.Command("go", "env", "GOROOT"))
 		if err != nil {
-			panic(err)
+			return environmentError(fmt.Errorf("go env GOROOT: %w", err), "make sure the go toolchain is in PATH")
 		}
 		goroot = strings.TrimSpace(string(out))
 	}
 
-	outDir := filepath.Dir(wasm)
-
-	wasmExecJs := filepath.Join(goroot, "misc", "wasm", "wasm_exec.js")
-	fmt.Println("cp", wasmExecJs, filepath.Join(outDir, "wasm_exec.js"))
-	err := cp(wasmExecJs, filepath.Join(outDir, "wasm_exec.js"))
+	wasmExecJs, err := findWasmSupportFile(goroot, "wasm_exec.js")
 	if err != nil {
-		panic(err)
+		return environmentError(err, "make sure your go installation ships lib/wasm or misc/wasm")
 	}
-
-	wasmExecHtml := filepath.Join(goroot, "misc", "wasm", "wasm_exec.html")
-	fmt.Println("cp", wasmExecHtml, filepath.Join(outDir, "index.html"))
-	err = cp(wasmExecHtml, filepath.Join(outDir, "index.html"))
+	if !quiet {
+		fmt.Println("cp", wasmExecJs, filepath.Join(outDir, "wasm_exec.js"))
+	}
+	err = cp(wasmExecJs, filepath.Join(outDir, "wasm_exec.js"))
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	fmt.Printf("serving %s at %s\n", filepath.Dir(wasm), addr)
-	err = http.ListenAndServe(addr, http.FileServer(http.FS(os.DirFS(filepath.Dir(wasm)))))
+	wasmExecHtml, err := findWasmSupportFile(goroot, "wasm_exec.html")
 	if err != nil {
-		panic(err)
+		return environmentError(err, "make sure your go installation ships misc/wasm")
+	}
+	if !quiet {
+		fmt.Println("cp", wasmExecHtml, filepath.Join(outDir, "index.html"))
 	}
+	return cp(wasmExecHtml, filepath.Join(outDir, "index.html"))
+}
+
+// findWasmSupportFile finds file shipped with the go installation, go1.24
+// moved wasm_exec.js from "misc/wasm" to "lib/wasm"
+func findWasmSupportFile(goroot, name string) (string, error) {
+	var err error
+	for _, dir := range []string{"lib", "misc"} {
+		file := filepath.Join(goroot, dir, "wasm", name)
+		_, err = os.Stat(file)
+		if err == nil {
+			return file, nil
+		}
+	}
+
+	return "", fmt.Errorf("findWasmSupportFile: %w", err)
 }
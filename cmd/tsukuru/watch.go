@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// how often watched files are polled
+	watchInterval = 500 * time.Millisecond
+	// changes are considered settled after no further changes for this long,
+	// so that rapid saves result in a single rebuild
+	watchDebounce = 300 * time.Millisecond
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watcher polls files for changes
+type watcher struct {
+	// directories watched non-recursively
+	dirs []string
+	// directories watched recursively
+	trees []string
+	// directories skipped while walking trees, matched by full path
+	skipPaths []string
+	// directories skipped while walking trees, matched by name
+	skipNames []string
+
+	state map[string]fileState
+}
+
+func (w *watcher) scan() map[string]fileState {
+	files := map[string]fileState{}
+
+	add := func(path string, d fs.DirEntry) {
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	for _, dir := range w.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			add(filepath.Join(dir, entry.Name()), entry)
+		}
+	}
+
+	for _, tree := range w.trees {
+		_ = filepath.WalkDir(tree, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if d.IsDir() {
+				if path != tree && (contains(w.skipNames, d.Name()) || contains(w.skipPaths, path)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			add(path, d)
+			return nil
+		})
+	}
+
+	return files
+}
+
+func (w *watcher) snapshot() {
+	w.state = w.scan()
+}
+
+func changed(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for path, sa := range a {
+		sb, ok := b[path]
+		if !ok || !sa.modTime.Equal(sb.modTime) || sa.size != sb.size {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until watched files change and then settle,
+// or until ctx is cancelled
+func (w *watcher) wait(ctx context.Context) error {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current := w.scan()
+		if !changed(w.state, current) {
+			continue
+		}
+
+		// debounce
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(watchDebounce):
+			}
+
+			next := w.scan()
+			if !changed(current, next) {
+				break
+			}
+			current = next
+		}
+
+		w.state = current
+		return nil
+	}
+}
+
+// goDepDirs lists directories of non standard library packages
+// that pkgs depend on
+func goDepDirs(pkgs []string, env ...string) ([]string, error) {
+	// -e, so that packages with errors are still watched
+	args := []string{"list", "-e", "-deps", "-f", "{{ if not .Standard }}{{ .Dir }}{{ end }}"}
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	args = append(args, pkgs...)
+
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, compileError(fmt.Errorf("goDepDirs: %w", err))
+	}
+
+	var dirs []string
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		dir := strings.TrimSpace(s.Text())
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs, nil
+}
+
+// fallbackWatchDirs returns the directories of pkgs and of the module
+// they are in, watched when goDepDirs fails before it ever succeeded,
+// e.g. for a broken import, so that fixing the error triggers a rebuild
+func fallbackWatchDirs(pkgs []string) []string {
+	var dirs []string
+	for _, pkg := range pkgs {
+		dir, err := filepath.Abs(pkg)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if !contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+
+		for d := dir; ; d = filepath.Dir(d) {
+			if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+				if !contains(dirs, d) {
+					dirs = append(dirs, d)
+				}
+				break
+			}
+			if filepath.Dir(d) == d {
+				break
+			}
+		}
+	}
+	return dirs
+}
+
+// watchAndroid builds, installs and launches the app every time go
+// dependencies of the built libraries or android directory change,
+// and streams logs of the running app
+func watchAndroid(ctx context.Context, mainPackagePath string) error {
+	adb, err := findAdb()
+	if err != nil {
+		return err
+	}
+
+	libs, err := androidLibraries(mainPackagePath)
+	if err != nil {
+		return err
+	}
+
+	w := &watcher{
+		trees: []string{androidDir},
+		// jniLibs and golibs are written by the build itself
+		skipPaths: []string{filepath.Join(androidDir, "app", "src", "main", "jniLibs"), goLibsDir()},
+		skipNames: androidOutputDirs,
+	}
+
+	for {
+		dirs, err := goDepDirs(libPackages(libs), "CGO_ENABLED=1", "GOOS=android")
+		if err != nil {
+			printError(err)
+			if len(w.dirs) == 0 {
+				w.dirs = fallbackWatchDirs(libPackages(libs))
+			}
+		} else {
+			w.dirs = dirs
+		}
+
+		// snapshot before building, so that changes made
+		// during the build trigger another one
+		w.snapshot()
+
+		stopLogcat := func() {}
+
+		pid, err := buildAndInstall(ctx, mainPackagePath, adb)
+		if err != nil {
+			printError(err)
+		} else {
+			logcatCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				err := logcat(logcatCtx, adb, pid)
+				if err != nil {
+					printError(err)
+				}
+			}()
+
+			stopLogcat = func() {
+				cancel()
+				<-done
+			}
+		}
+
+		info("Watching for changes...")
+		err = w.wait(ctx)
+		stopLogcat()
+		if err != nil {
+			return err
+		}
+
+		info("Change detected, rebuilding")
+	}
+}
+
+func buildAndInstall(ctx context.Context, mainPackagePath, adb string) (string, error) {
+	if !skipcheckin {
+		err := checkin(mainPackagePath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	apk, err := buildAndroid(ctx, mainPackagePath, "apk")
+	if err != nil {
+		return "", err
+	}
+
+	return installAndLaunch(adb, apk, true)
+}
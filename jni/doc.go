@@ -0,0 +1,22 @@
+// Package jni wraps JNIEnv and JavaVM for Go code called from java on
+// android, or calling into it.
+//
+// Native methods exported from Go get an Env from their JNIEnv argument:
+//
+//	//export Java_com_example_app_MainActivity_greeter
+//	func Java_com_example_app_MainActivity_greeter(env *C.JNIEnv, obj C.jobject) C.jstring {
+//		s, err := jni.EnvFrom(unsafe.Pointer(env)).NewString("Hello from Go!")
+//		if err != nil {
+//			return 0
+//		}
+//		return C.jstring(s)
+//	}
+//
+// cgo represents jobject and its subtypes as uintptr, so they convert to and
+// from Object directly. Goroutines not called from java, e.g. started by a
+// native method, use VM.Do to attach their thread to the VM.
+//
+// An Env is only valid on the thread it belongs to, and local references
+// only until the native method returns. Keep objects across calls or
+// threads with NewGlobalRef.
+package jni
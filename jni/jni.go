@@ -0,0 +1,475 @@
+//go:build android
+
+package jni
+
+/*
+
+#include <stdlib.h>
+#include <jni.h>
+
+static jint jni_GetEnv(JavaVM *vm, JNIEnv **env) {
+	return (*vm)->GetEnv(vm, (void **)env, JNI_VERSION_1_6);
+}
+
+static jint jni_AttachCurrentThread(JavaVM *vm, JNIEnv **env) {
+	return (*vm)->AttachCurrentThread(vm, env, NULL);
+}
+
+static jint jni_DetachCurrentThread(JavaVM *vm) {
+	return (*vm)->DetachCurrentThread(vm);
+}
+
+static jint jni_GetJavaVM(JNIEnv *env, JavaVM **vm) {
+	return (*env)->GetJavaVM(env, vm);
+}
+
+static jclass jni_FindClass(JNIEnv *env, const char *name) {
+	return (*env)->FindClass(env, name);
+}
+
+static jclass jni_GetObjectClass(JNIEnv *env, jobject obj) {
+	return (*env)->GetObjectClass(env, obj);
+}
+
+static jmethodID jni_GetMethodID(JNIEnv *env, jclass cls, const char *name, const char *sig) {
+	return (*env)->GetMethodID(env, cls, name, sig);
+}
+
+static jmethodID jni_GetStaticMethodID(JNIEnv *env, jclass cls, const char *name, const char *sig) {
+	return (*env)->GetStaticMethodID(env, cls, name, sig);
+}
+
+static jobject jni_NewObjectA(JNIEnv *env, jclass cls, jmethodID m, const jvalue *args) {
+	return (*env)->NewObjectA(env, cls, m, args);
+}
+
+// ret is the first character of the return type in the method signature
+static jvalue jni_CallMethodA(JNIEnv *env, jobject obj, jmethodID m, const jvalue *args, char ret) {
+	jvalue v;
+	v.j = 0;
+	switch (ret) {
+	case 'V': (*env)->CallVoidMethodA(env, obj, m, args); break;
+	case 'Z': v.z = (*env)->CallBooleanMethodA(env, obj, m, args); break;
+	case 'B': v.b = (*env)->CallByteMethodA(env, obj, m, args); break;
+	case 'C': v.c = (*env)->CallCharMethodA(env, obj, m, args); break;
+	case 'S': v.s = (*env)->CallShortMethodA(env, obj, m, args); break;
+	case 'I': v.i = (*env)->CallIntMethodA(env, obj, m, args); break;
+	case 'J': v.j = (*env)->CallLongMethodA(env, obj, m, args); break;
+	case 'F': v.f = (*env)->CallFloatMethodA(env, obj, m, args); break;
+	case 'D': v.d = (*env)->CallDoubleMethodA(env, obj, m, args); break;
+	default: v.l = (*env)->CallObjectMethodA(env, obj, m, args); break;
+	}
+	return v;
+}
+
+static jvalue jni_CallStaticMethodA(JNIEnv *env, jclass cls, jmethodID m, const jvalue *args, char ret) {
+	jvalue v;
+	v.j = 0;
+	switch (ret) {
+	case 'V': (*env)->CallStaticVoidMethodA(env, cls, m, args); break;
+	case 'Z': v.z = (*env)->CallStaticBooleanMethodA(env, cls, m, args); break;
+	case 'B': v.b = (*env)->CallStaticByteMethodA(env, cls, m, args); break;
+	case 'C': v.c = (*env)->CallStaticCharMethodA(env, cls, m, args); break;
+	case 'S': v.s = (*env)->CallStaticShortMethodA(env, cls, m, args); break;
+	case 'I': v.i = (*env)->CallStaticIntMethodA(env, cls, m, args); break;
+	case 'J': v.j = (*env)->CallStaticLongMethodA(env, cls, m, args); break;
+	case 'F': v.f = (*env)->CallStaticFloatMethodA(env, cls, m, args); break;
+	case 'D': v.d = (*env)->CallStaticDoubleMethodA(env, cls, m, args); break;
+	default: v.l = (*env)->CallStaticObjectMethodA(env, cls, m, args); break;
+	}
+	return v;
+}
+
+static jboolean jni_ExceptionCheck(JNIEnv *env) {
+	return (*env)->ExceptionCheck(env);
+}
+
+static jthrowable jni_ExceptionOccurred(JNIEnv *env) {
+	return (*env)->ExceptionOccurred(env);
+}
+
+static void jni_ExceptionClear(JNIEnv *env) {
+	(*env)->ExceptionClear(env);
+}
+
+static jint jni_ThrowNew(JNIEnv *env, jclass cls, const char *msg) {
+	return (*env)->ThrowNew(env, cls, msg);
+}
+
+static jobject jni_NewGlobalRef(JNIEnv *env, jobject obj) {
+	return (*env)->NewGlobalRef(env, obj);
+}
+
+static void jni_DeleteGlobalRef(JNIEnv *env, jobject obj) {
+	(*env)->DeleteGlobalRef(env, obj);
+}
+
+static void jni_DeleteLocalRef(JNIEnv *env, jobject obj) {
+	(*env)->DeleteLocalRef(env, obj);
+}
+
+static jint jni_PushLocalFrame(JNIEnv *env, jint capacity) {
+	return (*env)->PushLocalFrame(env, capacity);
+}
+
+static jobject jni_PopLocalFrame(JNIEnv *env, jobject result) {
+	return (*env)->PopLocalFrame(env, result);
+}
+
+static jstring jni_NewString(JNIEnv *env, const jchar *chars, jsize len) {
+	return (*env)->NewString(env, chars, len);
+}
+
+static jsize jni_GetStringLength(JNIEnv *env, jstring s) {
+	return (*env)->GetStringLength(env, s);
+}
+
+static void jni_GetStringRegion(JNIEnv *env, jstring s, jsize len, jchar *buf) {
+	(*env)->GetStringRegion(env, s, 0, len, buf);
+}
+
+static jbyteArray jni_NewByteArray(JNIEnv *env, const jbyte *bytes, jsize len) {
+	jbyteArray a = (*env)->NewByteArray(env, len);
+	if (a != NULL && len > 0) {
+		(*env)->SetByteArrayRegion(env, a, 0, len, bytes);
+	}
+	return a;
+}
+
+static jsize jni_GetArrayLength(JNIEnv *env, jarray a) {
+	return (*env)->GetArrayLength(env, a);
+}
+
+static void jni_GetByteArrayRegion(JNIEnv *env, jbyteArray a, jsize len, jbyte *buf) {
+	(*env)->GetByteArrayRegion(env, a, 0, len, buf);
+}
+
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// Object is a local or global reference to a java object, 0 is null.
+type Object uintptr
+
+// Class is a reference to a java class.
+type Class = Object
+
+// Method is a method ID along with the return type of its signature.
+type Method struct {
+	id  C.jmethodID
+	ret C.char
+}
+
+// Exception is a java exception thrown during a call, it's cleared
+// before being returned.
+type Exception struct {
+	// Throwable is a local reference to the exception.
+	Throwable Object
+	// Message is the result of its toString,
+	// e.g. "java.lang.IllegalStateException: closed".
+	Message string
+}
+
+func (e *Exception) Error() string { return e.Message }
+
+// Env is a JNIEnv, it's only valid on the thread it belongs to.
+type Env struct {
+	env *C.JNIEnv
+}
+
+// EnvFrom returns the Env of a JNIEnv pointer, e.g. the first argument of
+// native methods.
+func EnvFrom(env unsafe.Pointer) Env {
+	return Env{env: (*C.JNIEnv)(env)}
+}
+
+// VM is a JavaVM.
+type VM struct {
+	vm *C.JavaVM
+}
+
+// VMFrom returns the VM of a JavaVM pointer, e.g. the first argument
+// of JNI_OnLoad.
+func VMFrom(vm unsafe.Pointer) VM {
+	return VM{vm: (*C.JavaVM)(vm)}
+}
+
+// VM returns the VM e belongs to.
+func (e Env) VM() (VM, error) {
+	var vm *C.JavaVM
+	if C.jni_GetJavaVM(e.env, &vm) != C.JNI_OK {
+		return VM{}, errors.New("jni: GetJavaVM failed")
+	}
+	return VM{vm: vm}, nil
+}
+
+// Do calls fn with the Env of the current thread, which is attached to vm
+// while fn runs if it isn't already. The goroutine is locked to the thread
+// until fn returns.
+func (vm VM) Do(fn func(env Env) error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var env *C.JNIEnv
+	switch C.jni_GetEnv(vm.vm, &env) {
+	case C.JNI_OK:
+	case C.JNI_EDETACHED:
+		if C.jni_AttachCurrentThread(vm.vm, &env) != C.JNI_OK {
+			return errors.New("jni: AttachCurrentThread failed")
+		}
+		defer C.jni_DetachCurrentThread(vm.vm)
+	default:
+		return errors.New("jni: GetEnv failed, JNI 1.6 is not supported")
+	}
+
+	return fn(Env{env: env})
+}
+
+// exception returns the pending exception and clears it,
+// or nil if there is none
+func (e Env) exception() error {
+	if C.jni_ExceptionCheck(e.env) == C.JNI_FALSE {
+		return nil
+	}
+	t := C.jni_ExceptionOccurred(e.env)
+	C.jni_ExceptionClear(e.env)
+
+	msg := "java exception"
+	cls := C.jni_GetObjectClass(e.env, C.jobject(t))
+	cname := C.CString("toString")
+	csig := C.CString("()Ljava/lang/String;")
+	m := C.jni_GetMethodID(e.env, cls, cname, csig)
+	C.free(unsafe.Pointer(cname))
+	C.free(unsafe.Pointer(csig))
+	if m != nil {
+		v := C.jni_CallMethodA(e.env, C.jobject(t), m, nil, 'L')
+		s := *(*Object)(unsafe.Pointer(&v))
+		if C.jni_ExceptionCheck(e.env) == C.JNI_FALSE && s != 0 {
+			msg = e.GoString(s)
+			e.DeleteLocalRef(s)
+		}
+	}
+	// toString may have thrown too
+	C.jni_ExceptionClear(e.env)
+	e.DeleteLocalRef(Object(cls))
+
+	return &Exception{Throwable: Object(t), Message: msg}
+}
+
+// FindClass returns a local reference to the class of name, in the form
+// "java/lang/String". On threads attached with VM.Do only system classes
+// can be found, look up app classes from native methods and keep them
+// with NewGlobalRef.
+func (e Env) FindClass(name string) (Class, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	cls := C.jni_FindClass(e.env, cname)
+	if err := e.exception(); err != nil {
+		return 0, err
+	}
+	return Class(cls), nil
+}
+
+// GetObjectClass returns a local reference to the class of obj.
+func (e Env) GetObjectClass(obj Object) Class {
+	return Class(C.jni_GetObjectClass(e.env, C.jobject(obj)))
+}
+
+// GetMethodID looks up the instance method name of cls with the
+// signature sig, e.g. "(Ljava/lang/String;I)V".
+func (e Env) GetMethodID(cls Class, name, sig string) (Method, error) {
+	return e.getMethodID(cls, name, sig, false)
+}
+
+// GetStaticMethodID is like GetMethodID for static methods.
+func (e Env) GetStaticMethodID(cls Class, name, sig string) (Method, error) {
+	return e.getMethodID(cls, name, sig, true)
+}
+
+func (e Env) getMethodID(cls Class, name, sig string, static bool) (Method, error) {
+	i := strings.LastIndexByte(sig, ')')
+	if !strings.HasPrefix(sig, "(") || i < 0 || i == len(sig)-1 {
+		return Method{}, fmt.Errorf("jni: invalid method signature %q", sig)
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	csig := C.CString(sig)
+	defer C.free(unsafe.Pointer(csig))
+
+	var id C.jmethodID
+	if static {
+		id = C.jni_GetStaticMethodID(e.env, C.jclass(cls), cname, csig)
+	} else {
+		id = C.jni_GetMethodID(e.env, C.jclass(cls), cname, csig)
+	}
+	if err := e.exception(); err != nil {
+		return Method{}, err
+	}
+
+	return Method{id: id, ret: C.char(sig[i+1])}, nil
+}
+
+func values(args []Value) *C.jvalue {
+	if len(args) == 0 {
+		return nil
+	}
+	return (*C.jvalue)(unsafe.Pointer(&args[0]))
+}
+
+// CallMethod calls the instance method m of obj, the result is 0 for
+// void methods.
+func (e Env) CallMethod(obj Object, m Method, args ...Value) (Value, error) {
+	v := C.jni_CallMethodA(e.env, C.jobject(obj), m.id, values(args), m.ret)
+	if err := e.exception(); err != nil {
+		return 0, err
+	}
+	return *(*Value)(unsafe.Pointer(&v)), nil
+}
+
+// CallStaticMethod calls the static method m of cls.
+func (e Env) CallStaticMethod(cls Class, m Method, args ...Value) (Value, error) {
+	v := C.jni_CallStaticMethodA(e.env, C.jclass(cls), m.id, values(args), m.ret)
+	if err := e.exception(); err != nil {
+		return 0, err
+	}
+	return *(*Value)(unsafe.Pointer(&v)), nil
+}
+
+// NewObject creates an instance of cls with the constructor ctor, looked up
+// with GetMethodID(cls, "<init>", sig).
+func (e Env) NewObject(cls Class, ctor Method, args ...Value) (Object, error) {
+	obj := C.jni_NewObjectA(e.env, C.jclass(cls), ctor.id, values(args))
+	if err := e.exception(); err != nil {
+		return 0, err
+	}
+	return Object(obj), nil
+}
+
+// ThrowNew throws an exception of cls with msg, it's raised in java once
+// the native method returns.
+func (e Env) ThrowNew(cls Class, msg string) error {
+	cmsg := C.CString(msg)
+	defer C.free(unsafe.Pointer(cmsg))
+
+	if C.jni_ThrowNew(e.env, C.jclass(cls), cmsg) != C.JNI_OK {
+		return errors.New("jni: ThrowNew failed")
+	}
+	return nil
+}
+
+// ThrowError throws err as a java.lang.RuntimeException.
+func (e Env) ThrowError(err error) error {
+	cls, ferr := e.FindClass("java/lang/RuntimeException")
+	if ferr != nil {
+		return ferr
+	}
+	defer e.DeleteLocalRef(cls)
+	return e.ThrowNew(cls, err.Error())
+}
+
+// NewGlobalRef returns a reference to obj that stays valid across native
+// method calls and threads, until it's deleted with DeleteGlobalRef.
+func (e Env) NewGlobalRef(obj Object) Object {
+	return Object(C.jni_NewGlobalRef(e.env, C.jobject(obj)))
+}
+
+func (e Env) DeleteGlobalRef(obj Object) {
+	C.jni_DeleteGlobalRef(e.env, C.jobject(obj))
+}
+
+// DeleteLocalRef deletes a local reference before the native method
+// returns, e.g. in loops creating many objects.
+func (e Env) DeleteLocalRef(obj Object) {
+	C.jni_DeleteLocalRef(e.env, C.jobject(obj))
+}
+
+// PushLocalFrame starts a frame for at least capacity local references,
+// which are deleted by the matching PopLocalFrame.
+func (e Env) PushLocalFrame(capacity int) error {
+	if C.jni_PushLocalFrame(e.env, C.jint(capacity)) != C.JNI_OK {
+		if err := e.exception(); err != nil {
+			return err
+		}
+		return errors.New("jni: PushLocalFrame failed")
+	}
+	return nil
+}
+
+// PopLocalFrame deletes the local references of the current frame,
+// except result which is returned as a reference in the previous frame.
+func (e Env) PopLocalFrame(result Object) Object {
+	return Object(C.jni_PopLocalFrame(e.env, C.jobject(result)))
+}
+
+// NewString returns a java string holding s.
+func (e Env) NewString(s string) (Object, error) {
+	// NewStringUTF expects modified UTF-8, UTF-16 works for every string
+	buf := utf16.Encode([]rune(s))
+
+	// chars can't be NULL, even for ""
+	var empty uint16
+	p := &empty
+	if len(buf) > 0 {
+		p = &buf[0]
+	}
+
+	str := C.jni_NewString(e.env, (*C.jchar)(unsafe.Pointer(p)), C.jsize(len(buf)))
+	if err := e.exception(); err != nil {
+		return 0, err
+	}
+	return Object(str), nil
+}
+
+// GoString returns the contents of the java string s, "" if it's null.
+func (e Env) GoString(s Object) string {
+	if s == 0 {
+		return ""
+	}
+	n := C.jni_GetStringLength(e.env, C.jstring(s))
+	if n == 0 {
+		return ""
+	}
+	buf := make([]uint16, n)
+	C.jni_GetStringRegion(e.env, C.jstring(s), n, (*C.jchar)(unsafe.Pointer(&buf[0])))
+	return string(utf16.Decode(buf))
+}
+
+// NewByteArray returns a java byte[] holding a copy of b, null if b is nil.
+func (e Env) NewByteArray(b []byte) (Object, error) {
+	if b == nil {
+		return 0, nil
+	}
+
+	var p *C.jbyte
+	if len(b) > 0 {
+		p = (*C.jbyte)(unsafe.Pointer(&b[0]))
+	}
+	a := C.jni_NewByteArray(e.env, p, C.jsize(len(b)))
+	if err := e.exception(); err != nil {
+		return 0, err
+	}
+	return Object(a), nil
+}
+
+// GoBytes returns a copy of the java byte[] a, nil if it's null.
+func (e Env) GoBytes(a Object) []byte {
+	if a == 0 {
+		return nil
+	}
+	n := C.jni_GetArrayLength(e.env, C.jarray(a))
+	buf := make([]byte, n)
+	if n > 0 {
+		C.jni_GetByteArrayRegion(e.env, C.jbyteArray(a), n, (*C.jbyte)(unsafe.Pointer(&buf[0])))
+	}
+	return buf
+}
@@ -0,0 +1,36 @@
+//go:build android
+
+package jni
+
+import "math"
+
+// Value is a jvalue, an argument or result of a java method. Every android
+// ABI is little endian, so the field of the union in use is at the low
+// bits of Value.
+type Value uint64
+
+func Bool(b bool) Value {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func Byte(b int8) Value      { return Value(uint8(b)) }
+func Char(c uint16) Value    { return Value(c) }
+func Short(s int16) Value    { return Value(uint16(s)) }
+func Int(i int32) Value      { return Value(uint32(i)) }
+func Long(l int64) Value     { return Value(l) }
+func Float(f float32) Value  { return Value(math.Float32bits(f)) }
+func Double(d float64) Value { return Value(math.Float64bits(d)) }
+func Obj(o Object) Value     { return Value(o) }
+
+func (v Value) Bool() bool      { return uint8(v) != 0 }
+func (v Value) Byte() int8      { return int8(v) }
+func (v Value) Char() uint16    { return uint16(v) }
+func (v Value) Short() int16    { return int16(v) }
+func (v Value) Int() int32      { return int32(v) }
+func (v Value) Long() int64     { return int64(v) }
+func (v Value) Float() float32  { return math.Float32frombits(uint32(v)) }
+func (v Value) Double() float64 { return math.Float64frombits(uint64(v)) }
+func (v Value) Object() Object  { return Object(v) }
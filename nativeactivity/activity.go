@@ -0,0 +1,189 @@
+//go:build android
+
+package nativeactivity
+
+/*
+
+#cgo LDFLAGS: -landroid
+
+#include <android/configuration.h>
+#include <android/native_activity.h>
+#include <android/native_window.h>
+
+#include "nativeactivity.h"
+
+*/
+import "C"
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/rajveermalviya/tsukuru/jni"
+)
+
+var events = make(chan Event)
+
+// activities maps activities to their Activity, it is only accessed by the
+// callbacks which run on the main thread
+var activities = map[*C.ANativeActivity]*Activity{}
+
+// Events returns the channel events of the activities are sent on.
+func Events() <-chan Event {
+	return events
+}
+
+// Activity is an instance of the NativeActivity, valid until its
+// Lifecycle event with StageDestroyed is received.
+type Activity struct {
+	a *C.ANativeActivity
+}
+
+// VM returns the java VM of the app.
+func (a *Activity) VM() jni.VM {
+	return jni.VMFrom(unsafe.Pointer(a.a.vm))
+}
+
+// Object returns a global reference to the java object of the activity.
+func (a *Activity) Object() jni.Object {
+	return jni.Object(a.a.clazz)
+}
+
+// SdkVersion returns the api level of the device.
+func (a *Activity) SdkVersion() int {
+	return int(a.a.sdkVersion)
+}
+
+// InternalDataPath returns the directory for private files of the app.
+func (a *Activity) InternalDataPath() string {
+	return C.GoString(a.a.internalDataPath)
+}
+
+// ExternalDataPath returns the directory for files of the app on external
+// storage.
+func (a *Activity) ExternalDataPath() string {
+	return C.GoString(a.a.externalDataPath)
+}
+
+// AssetManager returns the AAssetManager of the app, for use with the
+// functions of <android/asset_manager.h>.
+func (a *Activity) AssetManager() unsafe.Pointer {
+	return unsafe.Pointer(a.a.assetManager)
+}
+
+// Finish finishes the activity, it is destroyed asynchronously.
+func (a *Activity) Finish() {
+	C.ANativeActivity_finish(a.a)
+}
+
+func (a *Activity) config() Config {
+	c := C.AConfiguration_new()
+	defer C.AConfiguration_delete(c)
+	C.AConfiguration_fromAssetManager(c, a.a.assetManager)
+
+	var lang, country [2]C.char
+	C.AConfiguration_getLanguage(c, &lang[0])
+	C.AConfiguration_getCountry(c, &country[0])
+
+	return Config{
+		Orientation:    Orientation(C.AConfiguration_getOrientation(c)),
+		Density:        int(C.AConfiguration_getDensity(c)),
+		ScreenWidthDp:  int(C.AConfiguration_getScreenWidthDp(c)),
+		ScreenHeightDp: int(C.AConfiguration_getScreenHeightDp(c)),
+		Language:       configCode(lang),
+		Country:        configCode(country),
+		Night:          C.AConfiguration_getUiModeNight(c) == C.ACONFIGURATION_UI_MODE_NIGHT_YES,
+	}
+}
+
+func configCode(code [2]C.char) string {
+	if code[0] == 0 {
+		return ""
+	}
+	return C.GoStringN(&code[0], C.int(len(code)))
+}
+
+// Window is the surface of an activity, valid until its WindowDestroyed
+// event is done.
+type Window struct {
+	w *C.ANativeWindow
+}
+
+// Pointer returns the ANativeWindow, e.g. for eglCreateWindowSurface or
+// vkCreateAndroidSurfaceKHR.
+func (w Window) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(w.w)
+}
+
+// Width returns the current width of the window in pixels.
+func (w Window) Width() int {
+	return int(C.ANativeWindow_getWidth(w.w))
+}
+
+// Height returns the current height of the window in pixels.
+func (w Window) Height() int {
+	return int(C.ANativeWindow_getHeight(w.w))
+}
+
+//export ANativeActivity_onCreate
+func ANativeActivity_onCreate(activity *C.ANativeActivity, savedState unsafe.Pointer, savedStateSize C.size_t) {
+	C.tsukuru_setCallbacks(activity)
+
+	a := &Activity{a: activity}
+	activities[activity] = a
+
+	events <- Lifecycle{Activity: a, Stage: StageCreated}
+	events <- ConfigChanged{Activity: a, Config: a.config()}
+}
+
+//export tsukuruLifecycle
+func tsukuruLifecycle(activity *C.ANativeActivity, stage C.int) {
+	a := activities[activity]
+
+	switch stage {
+	case C.TSUKURU_STARTED:
+		events <- Lifecycle{Activity: a, Stage: StageStarted}
+	case C.TSUKURU_RESUMED:
+		events <- Lifecycle{Activity: a, Stage: StageResumed}
+	case C.TSUKURU_PAUSED:
+		events <- Lifecycle{Activity: a, Stage: StagePaused}
+	case C.TSUKURU_STOPPED:
+		events <- Lifecycle{Activity: a, Stage: StageStopped}
+	case C.TSUKURU_DESTROYED:
+		events <- Lifecycle{Activity: a, Stage: StageDestroyed}
+		delete(activities, activity)
+	}
+}
+
+//export tsukuruFocusChanged
+func tsukuruFocusChanged(activity *C.ANativeActivity, hasFocus C.int) {
+	events <- FocusChanged{Activity: activities[activity], HasFocus: hasFocus != 0}
+}
+
+//export tsukuruWindow
+func tsukuruWindow(activity *C.ANativeActivity, window *C.ANativeWindow, change C.int) {
+	a, w := activities[activity], Window{w: window}
+
+	switch change {
+	case C.TSUKURU_WINDOW_CREATED:
+		events <- WindowCreated{Activity: a, Window: w}
+	case C.TSUKURU_WINDOW_RESIZED:
+		events <- WindowResized{Activity: a, Window: w}
+	case C.TSUKURU_WINDOW_REDRAW_NEEDED:
+		events <- WindowRedrawNeeded{Activity: a, Window: w}
+	case C.TSUKURU_WINDOW_DESTROYED:
+		done := make(chan struct{})
+		events <- WindowDestroyed{Activity: a, Window: w, done: done, once: new(sync.Once)}
+		<-done
+	}
+}
+
+//export tsukuruConfigChanged
+func tsukuruConfigChanged(activity *C.ANativeActivity) {
+	a := activities[activity]
+	events <- ConfigChanged{Activity: a, Config: a.config()}
+}
+
+//export tsukuruLowMemory
+func tsukuruLowMemory(activity *C.ANativeActivity) {
+	events <- LowMemory{Activity: activities[activity]}
+}
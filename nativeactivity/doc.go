@@ -0,0 +1,27 @@
+// Package nativeactivity implements ANativeActivity_onCreate for apps
+// without java code, using android.app.NativeActivity as their activity.
+//
+// Importing the package into the main package of the library named by the
+// android.app.lib_name meta-data of the activity is enough to export the
+// entry point, the callbacks of the activity are delivered as events:
+//
+//	func init() {
+//		go func() {
+//			for e := range nativeactivity.Events() {
+//				switch e := e.(type) {
+//				case nativeactivity.WindowCreated:
+//					// create a surface for e.Window.Pointer()
+//				case nativeactivity.WindowDestroyed:
+//					// stop using e.Window
+//					e.Done()
+//				}
+//			}
+//		}()
+//	}
+//
+//	func main() {}
+//
+// Callbacks run on the main thread of the app and block until their event
+// is received, so events have to be received promptly and long running
+// work, e.g. rendering, done on other goroutines.
+package nativeactivity
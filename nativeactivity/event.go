@@ -0,0 +1,185 @@
+//go:build android
+
+package nativeactivity
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is one of Lifecycle, FocusChanged, WindowCreated, WindowResized,
+// WindowRedrawNeeded, WindowDestroyed, KeyEvent, MotionEvent,
+// ConfigChanged and LowMemory.
+type Event interface{}
+
+type Stage int
+
+const (
+	StageCreated Stage = iota
+	StageStarted
+	StageResumed
+	StagePaused
+	StageStopped
+	StageDestroyed
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageCreated:
+		return "created"
+	case StageStarted:
+		return "started"
+	case StageResumed:
+		return "resumed"
+	case StagePaused:
+		return "paused"
+	case StageStopped:
+		return "stopped"
+	case StageDestroyed:
+		return "destroyed"
+	}
+	return "unknown"
+}
+
+// Lifecycle is sent when the activity enters Stage, see
+// https://developer.android.com/guide/components/activities/activity-lifecycle
+type Lifecycle struct {
+	Activity *Activity
+	Stage    Stage
+}
+
+// FocusChanged is sent when the window of the activity gains or loses
+// input focus.
+type FocusChanged struct {
+	Activity *Activity
+	HasFocus bool
+}
+
+type WindowCreated struct {
+	Activity *Activity
+	Window   Window
+}
+
+type WindowResized struct {
+	Activity *Activity
+	Window   Window
+}
+
+// WindowRedrawNeeded is sent when the window has to be redrawn, e.g. after
+// being resized, to avoid showing stale content.
+type WindowRedrawNeeded struct {
+	Activity *Activity
+	Window   Window
+}
+
+// WindowDestroyed is sent before the window is destroyed, the main thread
+// is blocked until Done is called, the window must not be used after that.
+type WindowDestroyed struct {
+	Activity *Activity
+	Window   Window
+
+	done chan struct{}
+	// copies of the event share it, so that Done can be called more than once
+	once *sync.Once
+}
+
+func (e WindowDestroyed) Done() {
+	e.once.Do(func() { close(e.done) })
+}
+
+type KeyAction int32
+
+// AKEY_EVENT_ACTION_* values
+const (
+	KeyDown     KeyAction = 0
+	KeyUp       KeyAction = 1
+	KeyMultiple KeyAction = 2
+)
+
+type KeyEvent struct {
+	Action KeyAction
+	// AKEYCODE_* value, e.g. 4 for the back key
+	Code int32
+	// AMETA_* flags of pressed modifier keys
+	Meta int32
+	// number of repeats of a held down key
+	Repeat   int
+	DeviceID int32
+	// AINPUT_SOURCE_* value of the device
+	Source int32
+	// time since boot
+	Time time.Duration
+}
+
+type MotionAction int32
+
+// AMOTION_EVENT_ACTION_* values
+const (
+	MotionDown        MotionAction = 0
+	MotionUp          MotionAction = 1
+	MotionMove        MotionAction = 2
+	MotionCancel      MotionAction = 3
+	MotionOutside     MotionAction = 4
+	MotionPointerDown MotionAction = 5
+	MotionPointerUp   MotionAction = 6
+	MotionHoverMove   MotionAction = 7
+	MotionScroll      MotionAction = 8
+	MotionHoverEnter  MotionAction = 9
+	MotionHoverExit   MotionAction = 10
+)
+
+type MotionEvent struct {
+	Action MotionAction
+	// index in Pointers of the pointer going down or up, for
+	// MotionPointerDown and MotionPointerUp
+	Index    int
+	Pointers []Pointer
+	DeviceID int32
+	// AINPUT_SOURCE_* value of the device
+	Source int32
+	// time since boot
+	Time time.Duration
+}
+
+// Pointer is a touching finger, stylus or mouse, ID identifies it across
+// events while it is down.
+type Pointer struct {
+	ID       int32
+	X, Y     float32
+	Pressure float32
+}
+
+type ConfigChanged struct {
+	Activity *Activity
+	Config   Config
+}
+
+// Orientation is an ACONFIGURATION_ORIENTATION_* value.
+type Orientation int
+
+const (
+	OrientationAny       Orientation = 0
+	OrientationPortrait  Orientation = 1
+	OrientationLandscape Orientation = 2
+)
+
+// Config is the device configuration the activity is running in, it is
+// sent after the activity is created and when it changes.
+type Config struct {
+	Orientation Orientation
+	// dpi of the screen
+	Density        int
+	ScreenWidthDp  int
+	ScreenHeightDp int
+	// two letter ISO-639 language and ISO-3166 country codes, empty if
+	// not set
+	Language string
+	Country  string
+	Night    bool
+}
+
+// LowMemory is sent when the system is running low on memory, caches
+// should be freed.
+type LowMemory struct {
+	Activity *Activity
+}
@@ -0,0 +1,55 @@
+//go:build android
+
+package nativeactivity
+
+/*
+
+#include <android/input.h>
+
+*/
+import "C"
+import "time"
+
+// tsukuruInputEvent sends event and returns whether it was handled, key
+// events are passed on to the system so the back key finishes the activity
+//
+//export tsukuruInputEvent
+func tsukuruInputEvent(event *C.AInputEvent) C.int {
+	switch C.AInputEvent_getType(event) {
+	case C.AINPUT_EVENT_TYPE_KEY:
+		events <- KeyEvent{
+			Action:   KeyAction(C.AKeyEvent_getAction(event)),
+			Code:     int32(C.AKeyEvent_getKeyCode(event)),
+			Meta:     int32(C.AKeyEvent_getMetaState(event)),
+			Repeat:   int(C.AKeyEvent_getRepeatCount(event)),
+			DeviceID: int32(C.AInputEvent_getDeviceId(event)),
+			Source:   int32(C.AInputEvent_getSource(event)),
+			Time:     time.Duration(C.AKeyEvent_getEventTime(event)),
+		}
+		return 0
+
+	case C.AINPUT_EVENT_TYPE_MOTION:
+		action := C.AMotionEvent_getAction(event)
+
+		e := MotionEvent{
+			Action:   MotionAction(action & C.AMOTION_EVENT_ACTION_MASK),
+			Index:    int((action & C.AMOTION_EVENT_ACTION_POINTER_INDEX_MASK) >> C.AMOTION_EVENT_ACTION_POINTER_INDEX_SHIFT),
+			DeviceID: int32(C.AInputEvent_getDeviceId(event)),
+			Source:   int32(C.AInputEvent_getSource(event)),
+			Time:     time.Duration(C.AMotionEvent_getEventTime(event)),
+		}
+		n := C.AMotionEvent_getPointerCount(event)
+		for i := C.size_t(0); i < n; i++ {
+			e.Pointers = append(e.Pointers, Pointer{
+				ID:       int32(C.AMotionEvent_getPointerId(event, i)),
+				X:        float32(C.AMotionEvent_getX(event, i)),
+				Y:        float32(C.AMotionEvent_getY(event, i)),
+				Pressure: float32(C.AMotionEvent_getPressure(event, i)),
+			})
+		}
+		events <- e
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,96 @@
+//go:build android
+
+#include <android/input.h>
+#include <android/looper.h>
+#include <android/native_activity.h>
+
+#include "nativeactivity.h"
+#include "_cgo_export.h"
+
+static void onStart(ANativeActivity *activity) {
+	tsukuruLifecycle(activity, TSUKURU_STARTED);
+}
+
+static void onResume(ANativeActivity *activity) {
+	tsukuruLifecycle(activity, TSUKURU_RESUMED);
+}
+
+static void onPause(ANativeActivity *activity) {
+	tsukuruLifecycle(activity, TSUKURU_PAUSED);
+}
+
+static void onStop(ANativeActivity *activity) {
+	tsukuruLifecycle(activity, TSUKURU_STOPPED);
+}
+
+static void onDestroy(ANativeActivity *activity) {
+	tsukuruLifecycle(activity, TSUKURU_DESTROYED);
+}
+
+static void onWindowFocusChanged(ANativeActivity *activity, int hasFocus) {
+	tsukuruFocusChanged(activity, hasFocus);
+}
+
+static void onNativeWindowCreated(ANativeActivity *activity, ANativeWindow *window) {
+	tsukuruWindow(activity, window, TSUKURU_WINDOW_CREATED);
+}
+
+static void onNativeWindowResized(ANativeActivity *activity, ANativeWindow *window) {
+	tsukuruWindow(activity, window, TSUKURU_WINDOW_RESIZED);
+}
+
+static void onNativeWindowRedrawNeeded(ANativeActivity *activity, ANativeWindow *window) {
+	tsukuruWindow(activity, window, TSUKURU_WINDOW_REDRAW_NEEDED);
+}
+
+static void onNativeWindowDestroyed(ANativeActivity *activity, ANativeWindow *window) {
+	tsukuruWindow(activity, window, TSUKURU_WINDOW_DESTROYED);
+}
+
+// onInput is called by the looper of the main thread when events are
+// available in the input queue passed as data
+static int onInput(int fd, int events, void *data) {
+	AInputQueue *queue = data;
+	AInputEvent *event = NULL;
+
+	while (AInputQueue_getEvent(queue, &event) >= 0) {
+		if (AInputQueue_preDispatchEvent(queue, event)) {
+			continue;
+		}
+		AInputQueue_finishEvent(queue, event, tsukuruInputEvent(event));
+	}
+	return 1;
+}
+
+static void onInputQueueCreated(ANativeActivity *activity, AInputQueue *queue) {
+	AInputQueue_attachLooper(queue, ALooper_forThread(), 0, onInput, queue);
+}
+
+static void onInputQueueDestroyed(ANativeActivity *activity, AInputQueue *queue) {
+	AInputQueue_detachLooper(queue);
+}
+
+static void onConfigurationChanged(ANativeActivity *activity) {
+	tsukuruConfigChanged(activity);
+}
+
+static void onLowMemory(ANativeActivity *activity) {
+	tsukuruLowMemory(activity);
+}
+
+void tsukuru_setCallbacks(ANativeActivity *activity) {
+	activity->callbacks->onStart = onStart;
+	activity->callbacks->onResume = onResume;
+	activity->callbacks->onPause = onPause;
+	activity->callbacks->onStop = onStop;
+	activity->callbacks->onDestroy = onDestroy;
+	activity->callbacks->onWindowFocusChanged = onWindowFocusChanged;
+	activity->callbacks->onNativeWindowCreated = onNativeWindowCreated;
+	activity->callbacks->onNativeWindowResized = onNativeWindowResized;
+	activity->callbacks->onNativeWindowRedrawNeeded = onNativeWindowRedrawNeeded;
+	activity->callbacks->onNativeWindowDestroyed = onNativeWindowDestroyed;
+	activity->callbacks->onInputQueueCreated = onInputQueueCreated;
+	activity->callbacks->onInputQueueDestroyed = onInputQueueDestroyed;
+	activity->callbacks->onConfigurationChanged = onConfigurationChanged;
+	activity->callbacks->onLowMemory = onLowMemory;
+}
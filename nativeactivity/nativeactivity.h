@@ -0,0 +1,25 @@
+#ifndef TSUKURU_NATIVEACTIVITY_H
+#define TSUKURU_NATIVEACTIVITY_H
+
+#include <android/native_activity.h>
+
+// stages and window changes passed from the callbacks of the activity to
+// tsukuruLifecycle and tsukuruWindow
+enum {
+	TSUKURU_STARTED,
+	TSUKURU_RESUMED,
+	TSUKURU_PAUSED,
+	TSUKURU_STOPPED,
+	TSUKURU_DESTROYED,
+};
+
+enum {
+	TSUKURU_WINDOW_CREATED,
+	TSUKURU_WINDOW_RESIZED,
+	TSUKURU_WINDOW_REDRAW_NEEDED,
+	TSUKURU_WINDOW_DESTROYED,
+};
+
+void tsukuru_setCallbacks(ANativeActivity *activity);
+
+#endif